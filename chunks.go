@@ -0,0 +1,150 @@
+package topn
+
+import (
+	"cmp"
+	"context"
+	"sort"
+)
+
+// SelectTopNChunks is SelectTopN over the logical concatenation of chunks, reordering the elements in place across the
+// chunks rather than copying them into one slice
+// Chunks may be of any length. Each block a worker claims is mapped onto its chunks once and then walked chunk by
+// chunk, by division when every chunk but the last has the same length (and the last is no longer), otherwise by a
+// search. Errors are as for SelectTopN with the total length of the chunks as that of the list.
+func SelectTopNChunks[T cmp.Ordered](chunks [][]T, n int, opts Options) (int, error) {
+	return SelectTopNChunksFunc(chunks, n, opts, cmp.Less[T])
+}
+
+// SelectTopNChunksFunc is SelectTopNChunks with the elements ordered by less, which must be a strict weak ordering
+func SelectTopNChunksFunc[T any](chunks [][]T, n int, opts Options, less func(a, b T) bool) (int, error) {
+	c := newChunked(chunks, opts, lessFor(opts.Order, less))
+	length := c.starts[len(chunks)]
+	if err := validateSelect(length, n, opts); err != nil {
+		return 0, err
+	}
+
+	return selectTop(context.Background(), c, length, n, opts)
+}
+
+// chunked the partitioner of the logical concatenation of chunks
+type chunked[T any] struct {
+	chunks [][]T
+	// starts the logical index of the first element of each chunk, followed by the total length
+	starts []int
+	// chunkSize the length of every chunk but the last, 0 when they differ or the last is longer
+	chunkSize      int
+	lessFunc       func(a, b T) bool
+	notGreaterFunc func(a, b T) bool
+	// current the ordering of the partition in progress, lessFunc or notGreaterFunc
+	current    func(a, b T) bool
+	blockSize  int
+	workers    int
+	pivotValue T
+
+	less   func(i, j int) bool
+	blocks blockPartition
+}
+
+// chunkCursor a position in the chunks, the offset into one of them
+type chunkCursor struct {
+	chunk  int
+	offset int
+}
+
+func newChunked[T any](chunks [][]T, opts Options, less func(a, b T) bool) *chunked[T] {
+	c := &chunked[T]{
+		chunks: chunks, starts: make([]int, len(chunks)+1), lessFunc: less, notGreaterFunc: notGreater(less), current: less,
+		blockSize: opts.blockSize(), workers: opts.Workers,
+	}
+	for i, chunk := range chunks {
+		c.starts[i+1] = c.starts[i] + len(chunk)
+	}
+	if len(chunks) > 0 && len(chunks[0]) > 0 && len(chunks[len(chunks)-1]) <= len(chunks[0]) {
+		c.chunkSize = len(chunks[0])
+		for _, chunk := range chunks[:len(chunks)-1] {
+			if len(chunk) != c.chunkSize {
+				c.chunkSize = 0
+				break
+			}
+		}
+	}
+
+	c.blocks.stats = opts.Stats
+	c.less = func(i, j int) bool {
+		return c.lessFunc(*c.at(i), *c.at(j))
+	}
+	w := &cursorWalk[chunkCursor]{
+		cursor: c.cursor,
+		next: func(k chunkCursor) chunkCursor {
+			c.next(&k)
+			return k
+		},
+		lessPivot: func(k chunkCursor) bool {
+			return c.current(*c.element(k), c.pivotValue)
+		},
+		swap: c.swap,
+	}
+	c.blocks.neutralise = w.neutralise
+	c.blocks.swapBlock = w.swapBlock
+	c.blocks.partition = w.partition
+
+	return c
+}
+
+// cursor the position of logical index i, which may be the total length
+func (c *chunked[T]) cursor(i int) chunkCursor {
+	if c.chunkSize > 0 {
+		return chunkCursor{i / c.chunkSize, i % c.chunkSize}
+	}
+	//The last chunk starting at or before i, skipping any empty chunks
+	chunk := sort.Search(len(c.chunks), func(k int) bool { return c.starts[k+1] > i })
+
+	return chunkCursor{chunk, i - c.starts[chunk]}
+}
+
+// next steps k on to the following logical index, over any empty chunks
+func (c *chunked[T]) next(k *chunkCursor) {
+	k.offset++
+	for k.chunk < len(c.chunks)-1 && k.offset >= len(c.chunks[k.chunk]) {
+		k.chunk++
+		k.offset = 0
+	}
+}
+
+// element the element at k
+func (c *chunked[T]) element(k chunkCursor) *T {
+	return &c.chunks[k.chunk][k.offset]
+}
+
+// at the element at logical index i
+func (c *chunked[T]) at(i int) *T {
+	return c.element(c.cursor(i))
+}
+
+func (c *chunked[T]) swap(x, y chunkCursor) {
+	a, b := c.element(x), c.element(y)
+	*a, *b = *b, *a
+}
+
+func (c *chunked[T]) indexLess() func(i, j int) bool {
+	return c.less
+}
+
+func (c *chunked[T]) setPivot(i int) {
+	c.pivotValue = *c.at(i)
+}
+
+func (c *chunked[T]) partition(ctx context.Context, left, right int, orEqual bool) (int, error) {
+	c.current = c.lessFunc
+	if orEqual {
+		c.current = c.notGreaterFunc
+	}
+
+	return partitionBlocks(ctx, &c.blocks, left, right, c.blockSize, c.workers)
+}
+
+func (c *chunked[T]) insertionSort(left, right int) {
+	insertionSortIndex(left, right, c.less, func(i, j int) {
+		c.swap(c.cursor(i), c.cursor(j))
+	})
+}
@@ -0,0 +1,91 @@
+package topn
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// chunk splits list into consecutive chunks of the given lengths, sharing its memory
+func chunk[T any](list []T, lengths []int) [][]T {
+	chunks := make([][]T, 0, len(lengths))
+	for _, length := range lengths {
+		chunks = append(chunks, list[:length:length])
+		list = list[length:]
+	}
+
+	return chunks
+}
+
+func TestSelectTopNChunks(t *testing.T) {
+	chunkings := map[string][]int{
+		"fixed":   {1000, 1000, 1000, 1000, 1000, 1000, 1000, 1000, 1000, 1000},
+		"partial": {3000, 3000, 3000, 1000},
+		"varied":  {1, 0, 4000, 37, 0, 2962, 3000},
+		"longer":  {2000, 2000, 6000},
+	}
+
+	for name, lengths := range chunkings {
+		for _, workers := range []int{1, 4} {
+			list := generateList(10 * 1000)
+			want := slices.Clone(list)
+			slices.Sort(want)
+			chunks := chunk(slices.Clone(list), lengths)
+			description := fmt.Sprint(name, " workers ", workers)
+
+			k, err := SelectTopNChunks(chunks, 4321, Options{BlockSize: 64, Workers: workers})
+
+			assert.NoError(t, err, description)
+			assert.Equal(t, 4321, k, description)
+			got := slices.Concat(chunks...)
+			top := slices.Clone(got[:4321])
+			slices.Sort(top)
+			assert.Equal(t, want[:4321], top, description)
+			assert.Equal(t, want[4321], got[4321], description)
+			slices.Sort(got)
+			assert.Equal(t, want, got, description)
+		}
+	}
+}
+
+func TestSelectTopNChunks_lastChunkLonger(t *testing.T) {
+	chunks := [][]int{{9, 8}, {7, 6, 5, 4, 3}}
+
+	k, err := SelectTopNChunks(chunks, 2, Options{BlockSize: 1, Workers: 1, Sorted: true})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, k)
+	assert.Equal(t, []int{3, 4}, chunks[0])
+	assert.Equal(t, 5, chunks[1][0])
+}
+
+func TestSelectTopNChunksFunc_sortedDescending(t *testing.T) {
+	list := make([]int, 1000)
+	for i := range list {
+		list[i] = rand.IntN(100)
+	}
+	want := slices.Clone(list)
+	slices.Sort(want)
+	slices.Reverse(want)
+	chunks := chunk(list, []int{300, 300, 300, 100})
+
+	_, err := SelectTopNChunksFunc(chunks, 50, Options{BlockSize: 16, Order: Descending, Sorted: true}, func(a, b int) bool { return a < b })
+
+	assert.NoError(t, err)
+	assert.Equal(t, want[:51], list[:51])
+}
+
+func TestSelectTopNChunks_errors(t *testing.T) {
+	_, err := SelectTopNChunks([][]int{}, 0, Options{})
+	assert.ErrorIs(t, err, ErrEmptyInput)
+	_, err = SelectTopNChunks([][]int{{}, {}}, 0, Options{})
+	assert.ErrorIs(t, err, ErrEmptyInput)
+
+	chunks := [][]int{{3, 2}, {1}}
+	_, err = SelectTopNChunks(chunks, 3, Options{})
+	assert.ErrorIs(t, err, ErrRankOutOfRange)
+	assert.Equal(t, [][]int{{3, 2}, {1}}, chunks)
+}
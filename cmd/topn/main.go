@@ -0,0 +1,236 @@
+// Command topn prints the smallest (or largest) N numbers of its input, selected with the parallel block partitioning
+// of the topn package rather than a full sort.
+//
+// Usage:
+//
+//	topn [flags] [file ...]
+//
+// Numbers are read one per line, or from the named column of CSV input with -column. With no files, or a file of "-",
+// stdin is read. Values print in their shortest form, so "1e2" prints as 100, and integers stay exact while every
+// value read is one.
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	topn "github.com/jamesk/parallel-top-n"
+)
+
+// numbers the values read so far, held as int64s until the first one that is not an integer, after which every value
+// is a float64
+// Integers are kept exact this way, a float64 cannot tell apart integers above 2^53.
+type numbers struct {
+	ints    []int64
+	floats  []float64
+	isFloat bool
+}
+
+// add parses text and appends its value
+func (ns *numbers) add(text string) error {
+	if !ns.isFloat {
+		if v, err := strconv.ParseInt(text, 10, 64); err == nil {
+			ns.ints = append(ns.ints, v)
+			return nil
+		}
+	}
+
+	v, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return fmt.Errorf("%q is not a number", text)
+	}
+	if !ns.isFloat {
+		ns.floats = make([]float64, len(ns.ints), len(ns.ints)+1)
+		for i, n := range ns.ints {
+			ns.floats[i] = float64(n)
+		}
+		ns.ints = nil
+		ns.isFloat = true
+	}
+	ns.floats = append(ns.floats, v)
+
+	return nil
+}
+
+type config struct {
+	n         int
+	blockSize int
+	workers   int
+	reverse   bool
+	sorted    bool
+	column    string
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintf(os.Stderr, "topn: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	c := config{}
+	flags := flag.NewFlagSet("topn", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.IntVar(&c.n, "n", 10, "number of values to print")
+	flags.IntVar(&c.blockSize, "block-size", topn.DefaultBlockSize, "number of values in each block claimed by a worker")
+	flags.IntVar(&c.workers, "workers", 0, "number of partitioning goroutines, 0 uses GOMAXPROCS")
+	flags.BoolVar(&c.reverse, "reverse", false, "select the largest values instead of the smallest")
+	flags.BoolVar(&c.sorted, "sorted", false, "print the selected values in order")
+	flags.StringVar(&c.column, "column", "", "read values from the named column of CSV input (with a header row)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if c.n < 0 {
+		return fmt.Errorf("-n must not be negative, got %v", c.n)
+	}
+	if c.blockSize <= 0 {
+		return fmt.Errorf("-block-size must be positive, got %v", c.blockSize)
+	}
+
+	files := flags.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	ns := &numbers{}
+	for _, name := range files {
+		if err := readFile(name, stdin, c.column, ns); err != nil {
+			return err
+		}
+	}
+
+	w := bufio.NewWriter(stdout)
+	if ns.isFloat {
+		top, err := selectNumbers(ns.floats, c)
+		if err != nil {
+			return err
+		}
+		for _, n := range top {
+			fmt.Fprintln(w, strconv.FormatFloat(n, 'g', -1, 64))
+		}
+	} else {
+		top, err := selectNumbers(ns.ints, c)
+		if err != nil {
+			return err
+		}
+		for _, n := range top {
+			fmt.Fprintln(w, strconv.FormatInt(n, 10))
+		}
+	}
+
+	return w.Flush()
+}
+
+// selectNumbers the first c.n numbers in the configured order, the returned slice aliases numbers
+func selectNumbers[T cmp.Ordered](numbers []T, c config) ([]T, error) {
+	opts := topn.Options{BlockSize: c.blockSize, Workers: c.workers, Sorted: c.sorted}
+	if c.reverse {
+		opts.Order = topn.Descending
+	}
+
+	n := min(c.n, len(numbers))
+	if n == 0 {
+		return nil, nil
+	}
+
+	//list[:rank+1] ends up selected, so when every number is wanted the last rank is the one to select
+	rank := min(n, len(numbers)-1)
+	if n < len(numbers) || c.sorted {
+		_, err := topn.SelectTopN(numbers, rank, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return numbers[:n], nil
+}
+
+func readFile(name string, stdin io.Reader, column string, ns *numbers) error {
+	r := stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		name = "stdin"
+	}
+
+	if column != "" {
+		return readCSV(name, r, column, ns)
+	}
+
+	return readLines(name, r, ns)
+}
+
+// readLines adds one number per non-blank line of r to ns
+func readLines(name string, r io.Reader, ns *numbers) error {
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		if err := ns.add(text); err != nil {
+			return fmt.Errorf("%v:%v: %w", name, line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%v: %w", name, err)
+	}
+
+	return nil
+}
+
+// readCSV adds the number in column of each record of r to ns, the first record is the header naming the columns
+func readCSV(name string, r io.Reader, column string, ns *numbers) error {
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%v: %w", name, err)
+	}
+	columnIndex := -1
+	for i, h := range header {
+		if strings.TrimSpace(h) == column {
+			columnIndex = i
+			break
+		}
+	}
+	if columnIndex < 0 {
+		return fmt.Errorf("%v: no column named %q", name, column)
+	}
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%v: %w", name, err)
+		}
+		line, _ := reader.FieldPos(columnIndex)
+
+		if err := ns.add(strings.TrimSpace(record[columnIndex])); err != nil {
+			return fmt.Errorf("%v:%v: %w", name, line, err)
+		}
+	}
+}
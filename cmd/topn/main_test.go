@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func runTopN(t *testing.T, args []string, stdin string) (string, error) {
+	t.Helper()
+	stdout := &bytes.Buffer{}
+	err := run(args, strings.NewReader(stdin), stdout, &bytes.Buffer{})
+	return stdout.String(), err
+}
+
+func TestRun_sorted(t *testing.T) {
+	out, err := runTopN(t, []string{"-n", "3", "-sorted", "-block-size", "2"}, "5\n3\n\n8\n1\n9.5\n2\n7\n")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "1\n2\n3\n", out)
+}
+
+func TestRun_reverse(t *testing.T) {
+	out, err := runTopN(t, []string{"-n", "2", "-sorted", "-reverse", "-workers", "2", "-block-size", "1"}, "5\n3\n8\n1\n9.5\n2\n7\n")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "9.5\n8\n", out)
+}
+
+func TestRun_unsorted(t *testing.T) {
+	out, err := runTopN(t, []string{"-n", "3"}, "5\n3\n8\n1\n2\n7\n")
+
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"1", "2", "3"}, strings.Fields(out))
+}
+
+func TestRun_moreThanInput(t *testing.T) {
+	out, err := runTopN(t, []string{"-n", "10", "-sorted"}, "3\n1e2\n-4\n")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "-4\n3\n100\n", out)
+}
+
+func TestRun_largeIntegers(t *testing.T) {
+	//2^53+1 and 2^53 are the same float64, as integers they stay apart
+	out, err := runTopN(t, []string{"-n", "1", "-sorted", "-reverse"}, "9007199254740992\n9007199254740993\n-9223372036854775808\n")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "9007199254740993\n", out)
+}
+
+func TestRun_integersThenFloats(t *testing.T) {
+	out, err := runTopN(t, []string{"-n", "3", "-sorted", "-block-size", "1"}, "5\n3\n8\n-0.5\n2\n")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "-0.5\n2\n3\n", out)
+}
+
+func TestRun_csvFiles(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.csv")
+	b := filepath.Join(dir, "b.csv")
+	assert.NoError(t, os.WriteFile(a, []byte("path,latency\n/a,120\n/b,15\n/c,300\n"), 0o644))
+	assert.NoError(t, os.WriteFile(b, []byte("latency,path\n42,/d\n7,/e\n"), 0o644))
+
+	out, err := runTopN(t, []string{"-n", "2", "-sorted", "-column", "latency", a, "-", b}, "latency\n1\n")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "1\n7\n", out)
+}
+
+func TestRun_errors(t *testing.T) {
+	cases := []struct {
+		args  []string
+		stdin string
+		err   string
+	}{
+		{[]string{}, "1\nten\n", `stdin:2: "ten" is not a number`},
+		{[]string{"-column", "latency"}, "path,duration\n/a,1\n", `stdin: no column named "latency"`},
+		{[]string{"-column", "latency"}, "latency\n1\nx\n", `stdin:3: "x" is not a number`},
+		{[]string{"-n", "-1"}, "", "-n must not be negative"},
+		{[]string{"-block-size", "0"}, "", "-block-size must be positive"},
+		{[]string{filepath.Join(t.TempDir(), "missing")}, "", "no such file or directory"},
+	}
+
+	for _, c := range cases {
+		_, err := runTopN(t, c.args, c.stdin)
+		if assert.Error(t, err, "%v", c.args) {
+			assert.Contains(t, err.Error(), c.err)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package topn
+
+import (
+	"context"
+)
+
+// Interface a container selected from by index, for containers that are not slices (ring buffers, paged arrays, mapped
+// columns), mirroring sort.Interface with the comparisons against the pivot of each round added
+// Swap and ComparePivot are called from several workers at once, but never with the same index on two of them, Len,
+// Less and SetPivot are only called between partitions.
+type Interface interface {
+	// Len the number of elements in the container
+	Len() int
+	// Less whether the element at index i is less than the element at index j, a strict weak ordering
+	Less(i, j int) bool
+	// Swap swaps the elements at indices i and j
+	Swap(i, j int)
+	// SetPivot holds a copy of the element at index i as the pivot, which must not change as the elements are swapped
+	SetPivot(i int)
+	// ComparePivot compares the element at index i with the pivot, as cmp.Compare does
+	ComparePivot(i int) int
+}
+
+// SelectTopNInterface is SelectTopN over data, which is left with its n smallest (or with Descending, largest)
+// elements at indices [0, n), and the next one at index n
+// Errors are as for SelectTopN.
+func SelectTopNInterface(data Interface, n int, opts Options) (int, error) {
+	return SelectTopNInterfaceContext(context.Background(), data, n, opts)
+}
+
+// SelectTopNInterfaceContext is SelectTopNInterface abandoned once ctx is done, as for SelectTopNContext
+func SelectTopNInterfaceContext(ctx context.Context, data Interface, n int, opts Options) (int, error) {
+	length := data.Len()
+	if err := validateSelect(length, n, opts); err != nil {
+		return 0, err
+	}
+	if opts.Order == Descending {
+		data = reverse{data}
+	}
+
+	return selectTop(ctx, newInterfacePartitioner(data, opts), length, n, opts)
+}
+
+// reverse orders an Interface the other way round, as sort.Reverse does
+type reverse struct {
+	Interface
+}
+
+func (r reverse) Less(i, j int) bool {
+	return r.Interface.Less(j, i)
+}
+
+func (r reverse) ComparePivot(i int) int {
+	return -r.Interface.ComparePivot(i)
+}
+
+// interfacePartitioner the partitioner of an Interface, partitioning it block by block with partitionBlocks
+type interfacePartitioner struct {
+	data      Interface
+	blockSize int
+	workers   int
+	// bound elements comparing to the pivot below it are partitioned to the left
+	bound  int
+	blocks blockPartition
+}
+
+func newInterfacePartitioner(data Interface, opts Options) *interfacePartitioner {
+	p := &interfacePartitioner{data: data, blockSize: opts.blockSize(), workers: opts.Workers}
+	p.blocks.stats = opts.Stats
+	w := &cursorWalk[int]{
+		cursor: func(i int) int { return i },
+		next:   func(i int) int { return i + 1 },
+		lessPivot: func(i int) bool {
+			return p.data.ComparePivot(i) < p.bound
+		},
+		swap: data.Swap,
+	}
+	p.blocks.neutralise = w.neutralise
+	p.blocks.swapBlock = w.swapBlock
+	p.blocks.partition = w.partition
+
+	return p
+}
+
+func (p *interfacePartitioner) indexLess() func(i, j int) bool {
+	return p.data.Less
+}
+
+func (p *interfacePartitioner) setPivot(i int) {
+	p.data.SetPivot(i)
+}
+
+func (p *interfacePartitioner) partition(ctx context.Context, left, right int, orEqual bool) (int, error) {
+	//Elements are less than the pivot below this comparison
+	p.bound = 0
+	if orEqual {
+		p.bound = 1
+	}
+
+	return partitionBlocks(ctx, &p.blocks, left, right, p.blockSize, p.workers)
+}
+
+func (p *interfacePartitioner) insertionSort(left, right int) {
+	insertionSortIndex(left, right, p.data.Less, p.data.Swap)
+}
+
+// insertionSortIndex is insertionSortFunc with the elements only touched by index
+func insertionSortIndex(left int, right int, less func(i, j int) bool, swap func(i, j int)) {
+	for i := left + 1; i <= right; i++ {
+		for j := i; j > left && less(j, j-1); j-- {
+			swap(j, j-1)
+		}
+	}
+}
+
+// cursorWalk the accessors the partitioners of containers that are not slices walk the elements through, a cursor of
+// type C being a position in the container which is cheaper to step on from than to find afresh
+// Slices are walked by neutraliseFunc and partitionFunc themselves rather than through these indirect calls.
+type cursorWalk[C any] struct {
+	// cursor the position of index i
+	cursor func(i int) C
+	// next the position after c
+	next func(c C) C
+	// lessPivot whether the element at c is less than the pivot
+	lessPivot func(c C) bool
+	swap      func(a, b C)
+}
+
+// neutralise is neutraliseFunc over the elements w walks, each block walked from a cursor found once
+func (w *cursorWalk[C]) neutralise(left subListDefinition, i int, right subListDefinition, j int) (leftOrRight int, index int) {
+	leftLength := left.endIndex - left.beginIndex + 1
+	rightLength := right.endIndex - right.beginIndex + 1
+	x, y := w.cursor(left.beginIndex+i), w.cursor(right.beginIndex+j)
+
+	for i < leftLength && j < rightLength {
+		for ; i < leftLength; i++ {
+			if !w.lessPivot(x) {
+				break
+			}
+			x = w.next(x)
+		}
+
+		for ; j < rightLength; j++ {
+			if w.lessPivot(y) {
+				break
+			}
+			y = w.next(y)
+		}
+
+		if i == leftLength || j == rightLength {
+			break
+		}
+
+		w.swap(x, y)
+		i++
+		j++
+		x, y = w.next(x), w.next(y)
+	}
+
+	if i == leftLength && j == rightLength {
+		return 0, -1
+	}
+	if i == leftLength {
+		return -1, j //left is neutralised
+	}
+
+	return 1, i //right is neutralised
+}
+
+// swapBlock swaps the elements of blocks a and b pairwise, as many as the shorter of them holds
+func (w *cursorWalk[C]) swapBlock(a *subListDefinition, b *subListDefinition) {
+	x, y := w.cursor(a.beginIndex), w.cursor(b.beginIndex)
+	for k := 0; k < min(a.endIndex-a.beginIndex+1, b.endIndex-b.beginIndex+1); k++ {
+		w.swap(x, y)
+		x, y = w.next(x), w.next(y)
+	}
+}
+
+// partition is partitionFunc over [left, right] of the elements w walks
+func (w *cursorWalk[C]) partition(left, right int) int {
+	storeIndex, store := left, w.cursor(left)
+	for i, k := left, w.cursor(left); i <= right; i++ {
+		if w.lessPivot(k) {
+			w.swap(k, store)
+			storeIndex++
+			store = w.next(store)
+		}
+		k = w.next(k)
+	}
+
+	return storeIndex
+}
@@ -0,0 +1,133 @@
+package topn
+
+import (
+	"cmp"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ring a ring buffer of ints starting at head, so index 0 of the container is not index 0 of the buffer
+type ring struct {
+	buffer []int
+	head   int
+	pivot  int
+}
+
+func newRing(values []int, head int) *ring {
+	r := &ring{buffer: make([]int, len(values)), head: head}
+	for i, v := range values {
+		r.buffer[r.index(i)] = v
+	}
+
+	return r
+}
+
+func (r *ring) index(i int) int {
+	return (r.head + i) % len(r.buffer)
+}
+
+func (r *ring) Len() int {
+	return len(r.buffer)
+}
+
+func (r *ring) Less(i, j int) bool {
+	return r.buffer[r.index(i)] < r.buffer[r.index(j)]
+}
+
+func (r *ring) Swap(i, j int) {
+	r.buffer[r.index(i)], r.buffer[r.index(j)] = r.buffer[r.index(j)], r.buffer[r.index(i)]
+}
+
+func (r *ring) SetPivot(i int) {
+	r.pivot = r.buffer[r.index(i)]
+}
+
+func (r *ring) ComparePivot(i int) int {
+	return cmp.Compare(r.buffer[r.index(i)], r.pivot)
+}
+
+// values the elements of the ring in container order
+func (r *ring) values() []int {
+	return slices.Concat(r.buffer[r.head:], r.buffer[:r.head])
+}
+
+func TestSelectTopNInterface(t *testing.T) {
+	for _, sorted := range []bool{false, true} {
+		for _, workers := range []int{1, 4} {
+			for _, values := range []int{3, 1000 * 1000} {
+				list := make([]int, 10*1000)
+				for i := range list {
+					list[i] = rand.IntN(values)
+				}
+				want := slices.Clone(list)
+				slices.Sort(want)
+				data := newRing(list, 1234)
+				name := fmt.Sprint("sorted ", sorted, " workers ", workers, " values ", values)
+
+				k, err := SelectTopNInterface(data, 100, Options{BlockSize: 64, Workers: workers, Sorted: sorted})
+
+				assert.NoError(t, err, name)
+				assert.Equal(t, 100, k, name)
+				top := data.values()[:100]
+				if !sorted {
+					slices.Sort(top)
+				}
+				assert.Equal(t, want[:100], top, name)
+				assert.Equal(t, want[100], data.values()[100], name)
+				got := data.values()
+				slices.Sort(got)
+				assert.Equal(t, want, got, name)
+			}
+		}
+	}
+}
+
+func TestSelectTopNInterface_descending(t *testing.T) {
+	data := newRing([]int{5, 3, 8, 1, 9, 2, 7, 4, 6, 0}, 7)
+
+	k, err := SelectTopNInterface(data, 3, Options{BlockSize: 2, Order: Descending, Sorted: true})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, k)
+	assert.Equal(t, []int{9, 8, 7, 6}, data.values()[:4])
+}
+
+func TestSelectTopNInterface_errors(t *testing.T) {
+	_, err := SelectTopNInterface(newRing(nil, 0), 0, Options{})
+	assert.ErrorIs(t, err, ErrEmptyInput)
+
+	data := newRing([]int{3, 2, 1}, 1)
+	_, err = SelectTopNInterface(data, 3, Options{})
+	assert.ErrorIs(t, err, ErrRankOutOfRange)
+	_, err = SelectTopNInterface(data, 1, Options{BlockSize: -1})
+	assert.ErrorIs(t, err, ErrInvalidBlockSize)
+	assert.Equal(t, []int{3, 2, 1}, data.values())
+}
+
+func Test_cursorWalk_neutralise(t *testing.T) {
+	for n := 0; n < 1000; n++ {
+		list := generateList(20)
+		pivotValue := list[rand.IntN(len(list))]
+		left := subListDefinition{0, 9}
+		right := subListDefinition{10, 19}
+		i, j := rand.IntN(10), rand.IntN(10)
+		indexed := slices.Clone(list)
+		w := &cursorWalk[int]{
+			cursor:    func(i int) int { return i },
+			next:      func(i int) int { return i + 1 },
+			lessPivot: func(i int) bool { return indexed[i] < pivotValue },
+			swap:      func(i, j int) { indexed[i], indexed[j] = indexed[j], indexed[i] },
+		}
+
+		leftOrRight, index := neutraliseFunc(list, left, i, right, j, pivotValue, cmp.Less[int], nil)
+		leftOrRightIndex, indexIndex := w.neutralise(left, i, right, j)
+
+		assert.Equal(t, leftOrRight, leftOrRightIndex)
+		assert.Equal(t, index, indexIndex)
+		assert.Equal(t, list, indexed)
+	}
+}
@@ -1,14 +1,20 @@
-package main
+package topn
 
 import (
+	"cmp"
+	"context"
 	"fmt"
-	"math/rand"
+	"math"
+	"math/bits"
+	"runtime"
+	"slices"
 	"sort"
 	"sync"
+	"sync/atomic"
 )
 
-type LeftRightSubLists struct {
-	list            []int
+// leftRightSubLists hands out blocks of [left, right] from both ends, guarded by a mutex
+type leftRightSubLists struct {
 	left, right     int
 	length          int
 	blockSize       int
@@ -18,11 +24,16 @@ type LeftRightSubLists struct {
 	mutex           *sync.Mutex
 }
 
-func NewLeftRightSubLists(list []int, left int, right int, blockSize int) *LeftRightSubLists {
-	if len(list) == 0 {
-		return &LeftRightSubLists{
-			list, 0, 0, 0, blockSize, 0, -1, -1, &sync.Mutex{},
-		}
+// newLeftRightSubLists splits [left, right] into blocks of blockSize, the last block may be partial
+// It returns ErrInvalidBlockSize unless blockSize is positive.
+func newLeftRightSubLists(left int, right int, blockSize int) (*leftRightSubLists, error) {
+	if blockSize <= 0 {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBlockSize, blockSize)
+	}
+	if right < left {
+		return &leftRightSubLists{
+			0, 0, 0, blockSize, 0, -1, -1, &sync.Mutex{},
+		}, nil
 	}
 
 	length := right - left + 1
@@ -32,22 +43,33 @@ func NewLeftRightSubLists(list []int, left int, right int, blockSize int) *LeftR
 		totalBlocks++
 	}
 
-	return &LeftRightSubLists{
-		list, left, right, length, blockSize, totalBlocks, 0, totalBlocks - 1, &sync.Mutex{},
-	}
+	return &leftRightSubLists{
+		left, right, length, blockSize, totalBlocks, 0, totalBlocks - 1, &sync.Mutex{},
+	}, nil
 }
 
-type SubListDefinition struct {
+// subListDefinition an inclusive range of indices into a list
+type subListDefinition struct {
 	beginIndex int
 	endIndex   int
 }
 
-func (s *SubListDefinition) String() string {
+// Begin the first index of the sub list
+func (s *subListDefinition) Begin() int {
+	return s.beginIndex
+}
+
+// End the last index of the sub list (inclusive)
+func (s *subListDefinition) End() int {
+	return s.endIndex
+}
+
+func (s *subListDefinition) String() string {
 	return fmt.Sprintf("SL %v - %v", s.beginIndex, s.endIndex)
 }
 
 // TakeNextLeft Get the next left most block that is available
-func (s *LeftRightSubLists) TakeNextLeft() *SubListDefinition {
+func (s *leftRightSubLists) TakeNextLeft() *subListDefinition {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
@@ -63,7 +85,7 @@ func (s *LeftRightSubLists) TakeNextLeft() *SubListDefinition {
 	if right > s.right {
 		right = s.right
 	}
-	d := SubListDefinition{left, right}
+	d := subListDefinition{left, right}
 
 	//Update
 	s.leftBlockIndex++
@@ -72,7 +94,7 @@ func (s *LeftRightSubLists) TakeNextLeft() *SubListDefinition {
 }
 
 // TakeNextRight Get the next right most block that is available
-func (s *LeftRightSubLists) TakeNextRight() *SubListDefinition {
+func (s *leftRightSubLists) TakeNextRight() *subListDefinition {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
@@ -88,7 +110,7 @@ func (s *LeftRightSubLists) TakeNextRight() *SubListDefinition {
 	if right >= s.right {
 		right = s.right
 	}
-	d := SubListDefinition{left, right}
+	d := subListDefinition{left, right}
 
 	//Update
 	s.rightBlockIndex--
@@ -96,228 +118,999 @@ func (s *LeftRightSubLists) TakeNextRight() *SubListDefinition {
 	return &d
 }
 
+// subListClaimer hands out disjoint blocks of a list, working in from both ends
+type subListClaimer interface {
+	// TakeNextLeft Get the next left most block that is available, nil when every block has been claimed
+	TakeNextLeft() *subListDefinition
+	// TakeNextRight Get the next right most block that is available, nil when every block has been claimed
+	TakeNextRight() *subListDefinition
+}
+
+// atomicLeftRightSubLists is a lock-free equivalent of leftRightSubLists
+// The number of blocks claimed from each end are packed into a single word (left in the high 32 bits, right in the low
+// 32 bits) which is updated by compare-and-swap, so a claim never succeeds once the two ends have met. A range can
+// therefore be split into at most maxClaimableBlocks blocks.
+type atomicLeftRightSubLists struct {
+	left, right int
+	length      int
+	blockSize   int
+	totalBlocks int
+	claimed     atomic.Uint64
+	// blocks backs the definitions of the claimed blocks when reused by reset, nil allocates each one
+	blocks []subListDefinition
+}
+
+// newAtomicLeftRightSubLists splits [left, right] into blocks of blockSize, the last block may be partial
+// It returns ErrInvalidBlockSize unless blockSize is positive, and panics if that is more than maxClaimableBlocks
+// blocks.
+func newAtomicLeftRightSubLists(left int, right int, blockSize int) (*atomicLeftRightSubLists, error) {
+	if blockSize <= 0 {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBlockSize, blockSize)
+	}
+	if right < left {
+		return &atomicLeftRightSubLists{blockSize: blockSize}, nil
+	}
+
+	length := right - left + 1
+
+	return &atomicLeftRightSubLists{
+		left: left, right: right, length: length, blockSize: blockSize,
+		totalBlocks: claimableBlocks(length, blockSize),
+	}, nil
+}
+
+// maxClaimableBlocks the most blocks an atomicLeftRightSubLists can count the claims of from either end
+const maxClaimableBlocks = math.MaxUint32
+
+// claimableBlocks the number of blocks of blockSize length elements split into, panicking if there are more than
+// maxClaimableBlocks, as the claims from one end would then overflow into those from the other
+func claimableBlocks(length int, blockSize int) int {
+	totalBlocks := length / blockSize
+	if length%blockSize > 0 {
+		totalBlocks++
+	}
+	if uint64(totalBlocks) > maxClaimableBlocks {
+		panic(fmt.Sprintf("topn: %v blocks of %v elements is more than the %v that can be claimed", totalBlocks, blockSize, uint64(maxClaimableBlocks)))
+	}
+
+	return totalBlocks
+}
+
+// claimableBlockSize the smallest block size from blockSize up that splits length elements into no more than
+// maxClaimableBlocks blocks
+func claimableBlockSize(length int, blockSize int) int {
+	if length > 0 && uint64(length-1)/uint64(blockSize) >= maxClaimableBlocks {
+		return int(uint64(length-1)/maxClaimableBlocks + 1)
+	}
+
+	return blockSize
+}
+
+// TakeNextLeft Get the next left most block that is available
+func (s *atomicLeftRightSubLists) TakeNextLeft() *subListDefinition {
+	for {
+		claimed := s.claimed.Load()
+		leftBlocksClaimed, rightBlocksClaimed := int(claimed>>32), int(claimed&math.MaxUint32)
+		if leftBlocksClaimed+rightBlocksClaimed >= s.totalBlocks {
+			return nil
+		}
+
+		if s.claimed.CompareAndSwap(claimed, claimed+1<<32) {
+			return s.block(leftBlocksClaimed)
+		}
+	}
+}
+
+// TakeNextRight Get the next right most block that is available
+func (s *atomicLeftRightSubLists) TakeNextRight() *subListDefinition {
+	for {
+		claimed := s.claimed.Load()
+		leftBlocksClaimed, rightBlocksClaimed := int(claimed>>32), int(claimed&math.MaxUint32)
+		if leftBlocksClaimed+rightBlocksClaimed >= s.totalBlocks {
+			return nil
+		}
+
+		if s.claimed.CompareAndSwap(claimed, claimed+1) {
+			return s.block(s.totalBlocks - 1 - rightBlocksClaimed)
+		}
+	}
+}
+
+// block the definition of the block at blockIndex, the last block may be partial
+func (s *atomicLeftRightSubLists) block(blockIndex int) *subListDefinition {
+	left := s.left + blockIndex*s.blockSize
+	right := left + s.blockSize - 1 //Right is inclusive so -1
+	if right > s.right {
+		right = s.right
+	}
+
+	if s.blocks == nil {
+		return &subListDefinition{left, right}
+	}
+	s.blocks[blockIndex] = subListDefinition{left, right}
+	return &s.blocks[blockIndex]
+}
+
+// reset splits [left, right] into blocks of blockSize afresh, as newAtomicLeftRightSubLists does, reusing the
+// definitions of the blocks claimed before so that once grown claims no longer allocate
+// No block may still be being claimed, and the definitions handed out before are overwritten.
+func (s *atomicLeftRightSubLists) reset(left int, right int, blockSize int) {
+	s.left, s.right, s.length, s.blockSize = left, right, right-left+1, blockSize
+	s.totalBlocks = claimableBlocks(s.length, blockSize)
+	s.claimed.Store(0)
+	if cap(s.blocks) < s.totalBlocks {
+		s.blocks = make([]subListDefinition, s.totalBlocks)
+	}
+	s.blocks = s.blocks[:cap(s.blocks)]
+}
+
 // selectTopFaA select the top X elements of the list (inclusive)
-func selectTopFaA(list []int, top int, blockSize int) int {
-	left := 0
-	right := len(list) - 1
+// Each round is partitioned by partitionParallel using the given number of workers (<= 0 uses GOMAXPROCS)
+// Elements are ordered as cmp.Less orders them, so NaNs are the smallest floats
+func selectTopFaA[T cmp.Ordered](list []T, top int, blockSize int, workers int) int {
+	//Without a deadline the selection can't fail
+	k, _ := selectTopFaAFunc(context.Background(), list, top, Options{BlockSize: blockSize, Workers: workers}, cmp.Less[T])
+	return k
+}
+
+// selectTopFaAFunc select the top X elements of the list (inclusive) as ordered by less, using the block size, workers
+// and pivot strategy of opts
+// less must be a strict weak ordering, elements it considers equal may end up either side of top
+// Once the rounds have partitioned introselectWork times len(list) elements the pivots come from MedianOfMediansPivot
+// instead, which bounds the worst case to linear time whatever the input or strategy.
+// ctx is checked between rounds and between block claims, when it is done ctx.Err() is returned with the list left a
+// permutation of its original elements.
+func selectTopFaAFunc[T any](ctx context.Context, list []T, top int, opts Options, less func(a, b T) bool) (int, error) {
+	return selectTopRange(ctx, newSlicePartitioner(list, opts, less), 0, len(list)-1, top, opts)
+}
+
+// introselectWork how many times the length of its range a selection partitions before its pivots come from
+// MedianOfMediansPivot
+const introselectWork = 8
+
+// partitioner the operations the selection rounds make on a list, all by index, so that the same rounds select from a
+// slice or an Interface
+type partitioner interface {
+	// indexLess whether element i is less than element j, for choosing pivots
+	indexLess() func(i, j int) bool
+	// setPivot holds a copy of element i as the pivot of the following partitions
+	setPivot(i int)
+	// partition partitions [left, right] in parallel, returning the index of the first element not less than the pivot,
+	// or with orEqual the first element greater than it
+	partition(ctx context.Context, left, right int, orEqual bool) (int, error)
+	// insertionSort sorts the short range [left, right]
+	insertionSort(left, right int)
+}
+
+// slicePartitioner the partitioner of a slice ordered by less, mirroring every swap onto swap (unless nil)
+// Its closures and scratch buffers are made once and reused by every partition.
+type slicePartitioner[T any] struct {
+	list           []T
+	lessFunc       func(a, b T) bool
+	notGreaterFunc func(a, b T) bool
+	// current the ordering of the partition in progress, lessFunc or notGreaterFunc
+	current    func(a, b T) bool
+	swap       func(i, j int)
+	blockSize  int
+	workers    int
+	scheme     PartitionScheme
+	pivotValue T
+
+	less   func(i, j int) bool
+	blocks blockPartition
+	// temp the scratch block swapBlock swaps through
+	temp []T
+	// splits the scratch the StridedBlocks scheme gathers the splits of its workers in
+	splits []int
+}
+
+func newSlicePartitioner[T any](list []T, opts Options, less func(a, b T) bool) *slicePartitioner[T] {
+	p := &slicePartitioner[T]{
+		list: list, lessFunc: less, notGreaterFunc: notGreater(less), current: less, swap: opts.swap,
+		blockSize: opts.blockSize(), workers: opts.Workers, scheme: opts.Scheme,
+	}
+	p.blocks.stats = opts.Stats
+	p.less = func(i, j int) bool {
+		return p.lessFunc(p.list[i], p.list[j])
+	}
+	p.blocks.neutralise = func(l subListDefinition, i int, r subListDefinition, j int) (int, int) {
+		return neutraliseFunc(p.list, l, i, r, j, p.pivotValue, p.current, p.swap)
+	}
+	p.blocks.swapBlock = func(a *subListDefinition, b *subListDefinition) {
+		aSlice := p.list[a.beginIndex : a.endIndex+1]
+		bSlice := p.list[b.beginIndex : b.endIndex+1]
+
+		if len(p.temp) < len(aSlice) {
+			p.temp = make([]T, max(len(aSlice), p.blockSize))
+		}
+		temp := p.temp[:len(aSlice)]
+		copy(temp, aSlice)
+		copy(aSlice, bSlice)
+		copy(bSlice, temp)
+		if p.swap != nil {
+			for k := 0; k < min(len(aSlice), len(bSlice)); k++ {
+				p.swap(a.beginIndex+k, b.beginIndex+k)
+			}
+		}
+	}
+	p.blocks.partition = func(left, right int) int {
+		return partitionFunc(p.list, left, right, p.pivotValue, p.current, p.swap)
+	}
+
+	return p
+}
+
+func (p *slicePartitioner[T]) indexLess() func(i, j int) bool {
+	return p.less
+}
+
+func (p *slicePartitioner[T]) setPivot(i int) {
+	p.pivotValue = p.list[i]
+}
+
+func (p *slicePartitioner[T]) partition(ctx context.Context, left, right int, orEqual bool) (int, error) {
+	p.current = p.lessFunc
+	if orEqual {
+		p.current = p.notGreaterFunc
+	}
+
+	if p.scheme == StridedBlocks {
+		return partitionStridedFunc(ctx, p.list, left, right, p.blockSize, p.pivotValue, p.workers, p.current, p.swap, p.blocks.stats, &p.splits)
+	}
+
+	return partitionBlocks(ctx, &p.blocks, left, right, p.blockSize, p.workers)
+}
+
+func (p *slicePartitioner[T]) insertionSort(left, right int) {
+	insertionSortFunc(p.list, left, right, p.lessFunc, p.swap)
+}
+
+// selectTopRange select the top X elements of [left, right] (inclusive) of the list p partitions, as for
+// selectTopFaAFunc
+func selectTopRange(ctx context.Context, p partitioner, left, right int, top int, opts Options) (int, error) {
+	pivot, rng, less := opts.pivot(), opts.rand(), p.indexLess()
+
+	work, maxWork := 0, introselectWork*(right-left+1)
 	for {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
 		if left == right {
-			return left
+			return left, nil
 		}
+		length := right - left + 1
 
-		pivotIndex := left + rand.Intn(right-left+1)
-		pivotValue := list[pivotIndex]
+		p.setPivot(pivot.Pivot(rng, less, left, right, top))
 
-		//Shared mutable
-		s := NewLeftRightSubLists(list, left, right, blockSize)
-		remainingLeftBlocks := []*SubListDefinition{}
-		neutralisedLeftBlocks := []*SubListDefinition{}
-		remainingRightBlocks := []*SubListDefinition{}
-		neutralisedRightBlocks := []*SubListDefinition{}
-
-		//Start of "parallel" code
-		leftBlock := s.TakeNextLeft()
-		rightBlock := s.TakeNextRight()
-		i := 0
-		j := 0
-		for leftBlock != nil && rightBlock != nil {
-			//# fmt.Printf("before partition L: %v, R: %v, pivot index of %v, list %v\n", left, right, pivotIndex, list)
-			leftOrRight, index := neutralise(list, *leftBlock, i, *rightBlock, j, pivotValue)
-			//# fmt.Printf("after partition L: %v, R: %v, pivot index of %v, list %v\n", left, right, pivotIndex, list)
-
-			if leftOrRight > 0 {
-				//right block, all greater than or equal to pivot (neutralised), get another
-				neutralisedRightBlocks = append(neutralisedRightBlocks, rightBlock)
-				rightBlock = s.TakeNextRight()
-				j = 0
-				i = index
-			}
-			if leftOrRight < 0 {
-				//left block, all less than pivot (neutralised), get another
-				neutralisedLeftBlocks = append(neutralisedLeftBlocks, leftBlock)
-				leftBlock = s.TakeNextLeft()
-				j = index
-				i = 0
-			}
-			if leftOrRight == 0 {
-				//both neutralised
-				neutralisedLeftBlocks = append(neutralisedLeftBlocks, leftBlock)
-				neutralisedRightBlocks = append(neutralisedRightBlocks, rightBlock)
-				rightBlock = s.TakeNextRight()
-				leftBlock = s.TakeNextLeft()
-				j = 0
-				i = 0
-			}
+		lt, gt, err := partitionSplit(ctx, p, left, right)
+		if err != nil {
+			return 0, err
 		}
-		if leftBlock != nil {
-			remainingLeftBlocks = append(remainingLeftBlocks, leftBlock)
-		} else if rightBlock != nil {
-			remainingRightBlocks = append(remainingRightBlocks, rightBlock)
+		switch {
+		case top < lt:
+			right = lt - 1
+		case top < gt:
+			return top, nil
+		default:
+			left = gt
 		}
 
-		//Sequential copy of unneutralised blocks into middle
-		sort.Slice(remainingLeftBlocks, func(i, j int) bool {
-			return remainingLeftBlocks[i].beginIndex < remainingLeftBlocks[j].beginIndex
-		})
-		sort.Slice(neutralisedLeftBlocks, func(i, j int) bool {
-			return neutralisedLeftBlocks[i].beginIndex > neutralisedLeftBlocks[j].beginIndex
-		})
-		swapBlock := func(a *SubListDefinition, b *SubListDefinition) {
-			aSlice := list[a.beginIndex : a.endIndex+1]
-			bSlice := list[b.beginIndex : b.endIndex+1]
+		//Introselect guard
+		work += length
+		if work > maxWork {
+			pivot = opts.medianOfMedians()
+		}
+	}
+}
 
-			temp := make([]int, len(aSlice))
-			copy(temp, aSlice)
-			copy(aSlice, bSlice)
-			copy(bSlice, temp)
+// partitionSplit partitions [left, right] of the list p partitions around its pivot, which must be in the range, into
+// [left, lt) less than the pivot, [lt, gt) equal to it and [gt, right] not less than it
+// As in pdqsort the band equal to the pivot is only split off, by a second pass, when nothing is less than the pivot,
+// otherwise it is left empty. Distinct elements then take a single pass, and either side is always shorter than the
+// range.
+func partitionSplit(ctx context.Context, p partitioner, left, right int) (lt int, gt int, err error) {
+	lt, err = p.partition(ctx, left, right, false)
+	if err != nil || lt > left {
+		return lt, lt, err
+	}
+	gt, err = p.partition(ctx, lt, right, true)
+
+	return lt, gt, err
+}
+
+// partitionThreeWay three-way partitions [left, right] of the list p partitions around its pivot, as for
+// partitionParallel3Func
+func partitionThreeWay(ctx context.Context, p partitioner, left, right int) (lt int, gt int, err error) {
+	lt, err = p.partition(ctx, left, right, false)
+	if err != nil || lt > right {
+		return lt, lt, err
+	}
+	gt, err = p.partition(ctx, lt, right, true)
+
+	return lt, gt, err
+}
+
+// insertionSortThreshold ranges this short are insertion sorted rather than partitioned any further
+const insertionSortThreshold = 12
+
+// sortFaAFunc sorts list[left:right+1] as ordered by less, a quicksort partitioning each range with partitionParallel
+// Only the smaller side of each partition is recursed into, so the stack depth is logarithmic in the range length
+// Cancellation is as for selectTopFaAFunc, an aborted sort leaves the range a permutation of its original elements.
+func sortFaAFunc[T any](ctx context.Context, list []T, left int, right int, opts Options, less func(a, b T) bool) error {
+	return sortRange(ctx, newSlicePartitioner(list, opts, less), left, right, opts)
+}
+
+// sortRange sorts [left, right] of the list p partitions, as for sortFaAFunc
+func sortRange(ctx context.Context, p partitioner, left int, right int, opts Options) error {
+	//The recursion shares one source
+	opts.Rand = opts.rand()
+	return sortGuarded(ctx, p, left, right, opts, bits.Len(uint(right-left+1)))
+}
+
+// sortGuarded sorts [left, right] as for sortRange, once badRoundsLeft partitions along the way have kept more than
+// 7/8 of their range on one side the pivots come from MedianOfMediansPivot, which bounds the worst case to O(n log n)
+func sortGuarded(ctx context.Context, p partitioner, left int, right int, opts Options, badRoundsLeft int) error {
+	pivot, rng, less := opts.pivot(), opts.Rand, p.indexLess()
+
+	for right-left+1 > insertionSortThreshold {
+		if err := ctx.Err(); err != nil {
+			return err
 		}
+		length := right - left + 1
+		p.setPivot(pivot.Pivot(rng, less, left, right, left+(right-left)/2))
 
-		nI := 0
-		for _, s := range remainingLeftBlocks {
-			if nI >= len(neutralisedLeftBlocks) {
-				break
-			}
+		lt, gt, err := partitionSplit(ctx, p, left, right)
+		if err != nil {
+			return err
+		}
 
-			swapBlock(s, neutralisedLeftBlocks[nI])
-			nI++
-		}
-		{
-			sort.Slice(remainingRightBlocks, func(i, j int) bool {
-				return remainingRightBlocks[i].beginIndex > remainingRightBlocks[j].beginIndex
-			})
-			sort.Slice(neutralisedRightBlocks, func(i, j int) bool {
-				return neutralisedRightBlocks[i].beginIndex < neutralisedRightBlocks[j].beginIndex
-			})
-
-			nI := 0
-			for sI := 0; sI < len(remainingRightBlocks); {
-				if nI >= len(neutralisedRightBlocks) {
-					break
-				}
-				s := remainingRightBlocks[sI]
-				n := neutralisedRightBlocks[nI]
-
-				uLen := s.endIndex - s.beginIndex + 1
-				nLen := n.endIndex - n.beginIndex + 1
-
-				if uLen == nLen {
-					swapBlock(s, neutralisedRightBlocks[nI])
-					nI++
-					sI++
-				} else if uLen < nLen {
-					swapBlock(s, neutralisedRightBlocks[nI]) //rely on copy behaviour, will do at most min(uLen, nLen)
-					neutralisedRightBlocks[nI].beginIndex += uLen
-					sI++
-				} else if uLen > nLen {
-					partialS := &SubListDefinition{s.endIndex + 1 - nLen, s.endIndex}
-					swapBlock(partialS, n)
-					s.endIndex = partialS.beginIndex - 1
-					nI++
-				}
+		//Introsort guard, the recursion inherits what is left of the budget
+		if max(lt-left, right-gt) > length-length/8 {
+			badRoundsLeft--
+			if badRoundsLeft < 0 {
+				pivot = opts.medianOfMedians()
+				opts.Pivot = pivot
 			}
 		}
-		//Check and re-loop
-		if top == pivotIndex {
-			return pivotIndex
-		} else if top > pivotIndex {
-			for list[pivotIndex] == pivotValue {
-				if top == pivotIndex {
-					return pivotIndex
-				}
-				pivotIndex++
+
+		//The band equal to the pivot is already in place
+		if lt-left < right-gt {
+			err = sortGuarded(ctx, p, left, lt-1, opts, badRoundsLeft)
+			left = gt
+		} else {
+			err = sortGuarded(ctx, p, gt, right, opts, badRoundsLeft)
+			right = lt - 1
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	p.insertionSort(left, right)
+
+	return nil
+}
+
+// insertionSortFunc sorts the short range list[left:right+1] as ordered by less
+func insertionSortFunc[T any](list []T, left int, right int, less func(a, b T) bool, swap func(i, j int)) {
+	for i := left + 1; i <= right; i++ {
+		for j := i; j > left && less(list[j], list[j-1]); j-- {
+			list[j], list[j-1] = list[j-1], list[j]
+			if swap != nil {
+				swap(j, j-1)
 			}
-			left = pivotIndex
-		} else if top < pivotIndex {
-			for list[pivotIndex] == pivotValue {
-				if top == pivotIndex {
-					return pivotIndex
-				}
-				pivotIndex--
+		}
+	}
+}
+
+// selectRanksFunc places the element of each of the ranks of list[left:right+1] at its final index, as ordered by less
+// ranks must be sorted, without duplicates and within the range
+// Each round partitions around the middle requested rank and only descends into the sides still holding requested
+// ranks, the side with fewer of them recursively, so the stack depth is logarithmic in the number of ranks.
+// Cancellation is as for selectTopFaAFunc.
+func selectRanksFunc[T any](ctx context.Context, list []T, left int, right int, ranks []int, opts Options, less func(a, b T) bool) error {
+	return selectRanksRange(ctx, newSlicePartitioner(list, opts, less), left, right, ranks, opts)
+}
+
+// selectRanksRange places each of the ranks of [left, right] of the list p partitions, as for selectRanksFunc
+func selectRanksRange(ctx context.Context, p partitioner, left int, right int, ranks []int, opts Options) error {
+	//The recursion shares one source
+	opts.Rand = opts.rand()
+	pivot, rng, less := opts.pivot(), opts.Rand, p.indexLess()
+
+	work, maxWork := 0, introselectWork*(right-left+1)
+	for len(ranks) > 1 && right-left+1 > insertionSortThreshold {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		length := right - left + 1
+
+		p.setPivot(pivot.Pivot(rng, less, left, right, ranks[len(ranks)/2]))
+
+		lt, gt, err := partitionSplit(ctx, p, left, right)
+		if err != nil {
+			return err
+		}
+
+		//Ranks in the band equal to the pivot are already in place
+		below := ranks[:sort.SearchInts(ranks, lt)]
+		above := ranks[sort.SearchInts(ranks, gt):]
+		if len(below) < len(above) {
+			err = selectRanksRange(ctx, p, left, lt-1, below, opts)
+			left, ranks = gt, above
+		} else {
+			err = selectRanksRange(ctx, p, gt, right, above, opts)
+			right, ranks = lt-1, below
+		}
+		if err != nil {
+			return err
+		}
+
+		//Introselect guard, as for selectTopFaAFunc
+		work += length
+		if work > maxWork {
+			pivot = opts.medianOfMedians()
+		}
+	}
+
+	switch {
+	case len(ranks) == 0:
+		return nil
+	case right-left+1 <= insertionSortThreshold:
+		p.insertionSort(left, right)
+		return nil
+	default:
+		opts.Pivot = pivot
+		_, err := selectTopRange(ctx, p, left, right, ranks[0], opts)
+		return err
+	}
+}
+
+// neutraliseResult the blocks a single worker neutralised, and the block (if any) it was left holding
+type neutraliseResult struct {
+	remainingLeftBlocks    []*subListDefinition
+	neutralisedLeftBlocks  []*subListDefinition
+	remainingRightBlocks   []*subListDefinition
+	neutralisedRightBlocks []*subListDefinition
+	// backing the array the lists of a joined result are parts of
+	backing []*subListDefinition
+}
+
+// lists the lists of blocks of r
+func (r *neutraliseResult) lists() [4]*[]*subListDefinition {
+	return [4]*[]*subListDefinition{
+		&r.remainingLeftBlocks, &r.neutralisedLeftBlocks, &r.remainingRightBlocks, &r.neutralisedRightBlocks,
+	}
+}
+
+// reset empties r, keeping the capacity of its lists
+func (r *neutraliseResult) reset() {
+	for _, blocks := range r.lists() {
+		*blocks = (*blocks)[:0]
+	}
+}
+
+// join sets the lists of r to those of rs concatenated, as consecutive parts of one backing array grown to hold them
+func (r *neutraliseResult) join(rs []neutraliseResult) {
+	total := 0
+	for w := range rs {
+		for _, blocks := range rs[w].lists() {
+			total += len(*blocks)
+		}
+	}
+	if cap(r.backing) < total {
+		r.backing = make([]*subListDefinition, 0, total)
+	}
+
+	backing := r.backing[:0]
+	for k, blocks := range r.lists() {
+		begin := len(backing)
+		for w := range rs {
+			backing = append(backing, *rs[w].lists()[k]...)
+		}
+		*blocks = backing[begin:len(backing):len(backing)]
+	}
+}
+
+// partitionParallel3Func three-way partitions list[left:right+1] around pivotValue as ordered by less, returning lt the
+// index of the first element not less than pivotValue and gt the index of the first element greater than it, so that
+// list[lt:gt] is the band of elements equal to pivotValue
+// The elements not less than the pivot are split by a second partitionParallel pass which treats equal as less, always
+// run as the band must be exact, selection and sorting skip it where they can with partitionSplit
+func partitionParallel3Func[T any](ctx context.Context, list []T, left, right int, blockSize int, pivotValue T, workers int, less func(a, b T) bool, swap func(i, j int)) (lt int, gt int, err error) {
+	lt, err = partitionParallelFunc(ctx, list, left, right, blockSize, pivotValue, workers, less, swap)
+	if err != nil || lt > right {
+		return lt, lt, err
+	}
+	gt, err = partitionParallelFunc(ctx, list, lt, right, blockSize, pivotValue, workers, notGreater(less), swap)
+
+	return lt, gt, err
+}
+
+// notGreater turns less into less than or equal, partitioning with it puts elements equal to the pivot on the left
+func notGreater[T any](less func(a, b T) bool) func(a, b T) bool {
+	return func(a, b T) bool {
+		return !less(b, a)
+	}
+}
+
+// neutraliseBlocks neutralises the blocks claimed from s with neutralise on up to totalBlocks/2 workers, which steal
+// from each other once every block is claimed (see stealing), returning their results joined into the first of *results
+// Workers stop once ctx is done, the caller must then not rely on the result.
+func neutraliseBlocks(ctx context.Context, s subListClaimer, totalBlocks int, workers int, neutralise neutraliseBlockFunc, results *[]neutraliseResult, st *stealing) *neutraliseResult {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if maxWorkers := totalBlocks / 2; workers > maxWorkers {
+		workers = maxWorkers
+	}
+	workers = max(workers, 1)
+	if len(*results) < workers+1 {
+		*results = append(*results, make([]neutraliseResult, workers+1-len(*results))...)
+	}
+	//The first result is the one the others are joined into
+	joined, rs := &(*results)[0], (*results)[1:workers+1]
+	for w := range rs {
+		rs[w].reset()
+	}
+
+	done := ctx.Done()
+	if workers == 1 {
+		neutraliseAlone(done, s, neutralise, &rs[0])
+		joined.join(rs)
+		return joined
+	}
+
+	st.reset(workers)
+	wg := sync.WaitGroup{}
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func(w int) {
+			defer wg.Done()
+			neutraliseWorker(done, s, neutralise, st, w, &rs[w])
+		}(w)
+	}
+	wg.Wait()
+
+	//Along with the blocks still held, parked or abandoned when cancelled
+	for w := range st.slots {
+		for side := range st.slots[w] {
+			block, neutralised := st.slots[w][side].release(true)
+			rs[w].record(side, block, neutralised)
+		}
+	}
+	joined.join(rs)
+
+	return joined
+}
+
+// neutraliseAlone is neutraliseWorker for a lone worker, which having no one to steal from neutralises whole blocks
+// without reserving them, the blocks it is left holding are recorded as remaining
+func neutraliseAlone(done <-chan struct{}, s subListClaimer, neutralise neutraliseBlockFunc, r *neutraliseResult) {
+	var blocks [2]*subListDefinition
+	var indices [2]int
+	for !isDone(done) {
+		for side := range blocks {
+			if blocks[side] == nil {
+				blocks[side], indices[side] = claim(s, side), 0
 			}
-			right = pivotIndex
+		}
+		if blocks[leftSide] == nil || blocks[rightSide] == nil {
+			break
+		}
+
+		leftOrRight, index := neutralise(*blocks[leftSide], indices[leftSide], *blocks[rightSide], indices[rightSide])
+
+		if leftOrRight >= 0 {
+			r.record(rightSide, blocks[rightSide], true)
+			blocks[rightSide] = nil
+			indices[leftSide] = index
+		}
+		if leftOrRight <= 0 {
+			r.record(leftSide, blocks[leftSide], true)
+			blocks[leftSide] = nil
+			indices[rightSide] = index
 		}
 	}
 
+	for side, block := range blocks {
+		r.record(side, block, false)
+	}
 }
 
-func partitionParallel(list []int, left, right int, blockSize int, pivotValue int) int {
-	//# fmt.Printf("pp, left %v right %v blockSize %v, value %v, list %v\n", left, right, blockSize, pivotValue, list)
+// neutraliseBlockFunc neutralises the left block from i against the right block from j, returning as neutralise does
+type neutraliseBlockFunc func(left subListDefinition, i int, right subListDefinition, j int) (leftOrRight int, index int)
+
+// The sides of the range blocks are claimed from
+const (
+	leftSide = iota
+	rightSide
+)
+
+// claim the next block of side from s
+func claim(s subListClaimer, side int) *subListDefinition {
+	if side == leftSide {
+		return s.TakeNextLeft()
+	}
+
+	return s.TakeNextRight()
+}
 
-	//Shared mutable
-	s := NewLeftRightSubLists(list, left, right, blockSize)
-	if s.length <= blockSize {
-		//Shortcut if the list is equal to or smaller than blocksize
-		return partition(list, left, right, pivotValue)
+// record appends block to the blocks of side of r, neutralised or remaining, unless it is nil
+func (r *neutraliseResult) record(side int, block *subListDefinition, neutralised bool) {
+	if block == nil {
+		return
 	}
+	switch {
+	case side == leftSide && neutralised:
+		r.neutralisedLeftBlocks = append(r.neutralisedLeftBlocks, block)
+	case side == leftSide:
+		r.remainingLeftBlocks = append(r.remainingLeftBlocks, block)
+	case neutralised:
+		r.neutralisedRightBlocks = append(r.neutralisedRightBlocks, block)
+	default:
+		r.remainingRightBlocks = append(r.remainingRightBlocks, block)
+	}
+}
+
+// stepScan the step of a block a worker is neutralising on one side, scanned up to index
+type stepScan struct {
+	step  subListDefinition
+	index int
+	held  bool
+}
 
-	remainingLeftBlocks := []*SubListDefinition{}
-	neutralisedLeftBlocks := []*SubListDefinition{}
-	remainingRightBlocks := []*SubListDefinition{}
-	neutralisedRightBlocks := []*SubListDefinition{}
+// neutraliseWorker neutralises the blocks of each side against each other a step at a time, appending them to r, until
+// there are no more to claim or steal or done is closed
+func neutraliseWorker(done <-chan struct{}, s subListClaimer, neutralise neutraliseBlockFunc, st *stealing, w int, r *neutraliseResult) {
+	scans := [2]stepScan{}
+	for !isDone(done) {
+		for side := range scans {
+			if !scans[side].held {
+				scans[side] = st.claimStep(s, w, side, r)
+			}
+		}
+		for side := range scans {
+			if !scans[side].held {
+				if scans[side] = st.stealStep(w, side, &scans[1-side]); !scans[side].held {
+					return
+				}
+			}
+		}
 
-	//Start of "parallel" code
-	leftBlock := s.TakeNextLeft()
-	rightBlock := s.TakeNextRight()
-	i := 0
-	j := 0
-	for leftBlock != nil && rightBlock != nil {
-		//# fmt.Printf("before neutralise left %v, right %v, i %v, j %v, remaining left %v, right %v, neutralised left %v, right %v, list %v\n", leftBlock, rightBlock, i, j, remainingLeftBlocks, remainingRightBlocks, neutralisedLeftBlocks, neutralisedRightBlocks, list)
-		leftOrRight, index := neutralise(list, *leftBlock, i, *rightBlock, j, pivotValue)
-		//# fmt.Printf("after neutralise leftOrRight %v, index %v, list %v\n", leftOrRight, index, list)
+		left, right := &scans[leftSide], &scans[rightSide]
+		leftOrRight, index := neutralise(left.step, left.index, right.step, right.index)
 
 		if leftOrRight > 0 {
-			//right block, all greater than or equal to pivot (neutralised), get another
-			neutralisedRightBlocks = append(neutralisedRightBlocks, rightBlock)
-			rightBlock = s.TakeNextRight()
-			j = 0
-			i = index
+			//right step, all greater than or equal to pivot (neutralised), get another
+			right.held = false
+			left.index = index
 		}
 		if leftOrRight < 0 {
-			//left block, all less than pivot (neutralised), get another
-			neutralisedLeftBlocks = append(neutralisedLeftBlocks, leftBlock)
-			leftBlock = s.TakeNextLeft()
-			j = index
-			i = 0
+			//left step, all less than pivot (neutralised), get another
+			left.held = false
+			right.index = index
 		}
 		if leftOrRight == 0 {
 			//both neutralised
-			neutralisedLeftBlocks = append(neutralisedLeftBlocks, leftBlock)
-			neutralisedRightBlocks = append(neutralisedRightBlocks, rightBlock)
-			rightBlock = s.TakeNextRight()
-			leftBlock = s.TakeNextLeft()
-			j = 0
-			i = 0
+			left.held = false
+			right.held = false
 		}
 	}
-	if leftBlock != nil {
-		remainingLeftBlocks = append(remainingLeftBlocks, leftBlock)
-	} else if rightBlock != nil {
-		remainingRightBlocks = append(remainingRightBlocks, rightBlock)
+}
+
+// stealSteps the number of steps a block is reserved in by the worker holding it, other workers can steal the steps
+// not yet reserved
+const stealSteps = 4
+
+// stealing the blocks held by the workers of a neutralise phase
+// A worker reserves the block it holds on each side a step at a time. Once every block has been claimed, a worker that
+// needs a block steals the back half of what another worker has still to reserve of its block, so the workers still
+// holding blocks share out the tail of the round. A worker that finds nothing to steal parks the block it holds on the
+// other side from the index its scan stopped at, for another worker to carry on with. Stealing and parking are
+// serialised by mu, so only blocks of one side are ever parked.
+type stealing struct {
+	mu sync.Mutex
+	// slots the left and right blocks of each worker
+	slots [][2]stealSlot
+	// parkedOnly limits stealing to parked blocks, so that a worker finding none exits as it did before it could steal
+	parkedOnly bool
+}
+
+// stealSlot the block a worker holds on one side, nil when it holds none
+type stealSlot struct {
+	mu    sync.Mutex
+	block *subListDefinition
+	// next and end bound the part of block not yet reserved, [next, end]
+	next, end int
+	step      int
+	// shared counts the parts of block being scanned once it has been stolen from, nil until then
+	shared *sharedBlock
+	// parked whether the worker has stopped, leaving [next, end] to be carried on with
+	parked bool
+}
+
+// sharedBlock a block whose parts are scanned by several workers, the last of them to finish records it
+type sharedBlock struct {
+	parts  atomic.Int32
+	failed atomic.Bool
+}
+
+// reset empties st for workers workers
+func (st *stealing) reset(workers int) {
+	if cap(st.slots) < workers {
+		st.slots = make([][2]stealSlot, workers)
 	}
+	st.slots = st.slots[:workers]
+	for w := range st.slots {
+		for side := range st.slots[w] {
+			slot := &st.slots[w][side]
+			slot.block, slot.shared, slot.parked = nil, nil, false
+		}
+	}
+}
 
-	//# fmt.Printf("Loop done left %v, right %v, i %v, j %v, remaining left %v, right %v, neutralised left %v, right %v, list %v\n", leftBlock, rightBlock, i, j, remainingLeftBlocks, remainingRightBlocks, neutralisedLeftBlocks, neutralisedRightBlocks, list)
+// claimStep the next step of the block worker w holds on side, once that block is all reserved it is recorded in r
+// and another claimed from s, not held when there is none to claim
+func (st *stealing) claimStep(s subListClaimer, w int, side int, r *neutraliseResult) stepScan {
+	slot := &st.slots[w][side]
+	if step, ok := slot.reserve(); ok {
+		return stepScan{step: step, held: true}
+	}
+	block, neutralised := slot.release(false)
+	r.record(side, block, neutralised)
+	if block = claim(s, side); block == nil {
+		return stepScan{}
+	}
+	slot.hold(block)
+	step, ok := slot.reserve()
 
-	//Sequential copy of unneutralised blocks into middle
-	sort.Slice(remainingLeftBlocks, func(i, j int) bool {
-		return remainingLeftBlocks[i].beginIndex < remainingLeftBlocks[j].beginIndex
-	})
-	sort.Slice(neutralisedLeftBlocks, func(i, j int) bool {
-		return neutralisedLeftBlocks[i].beginIndex > neutralisedLeftBlocks[j].beginIndex
-	})
-	swapBlock := func(a *SubListDefinition, b *SubListDefinition) {
-		aSlice := list[a.beginIndex : a.endIndex+1]
-		bSlice := list[b.beginIndex : b.endIndex+1]
-
-		temp := make([]int, len(aSlice))
-		copy(temp, aSlice)
-		copy(aSlice, bSlice)
-		copy(bSlice, temp)
+	return stepScan{step: step, held: ok}
+}
+
+// stealStep the first step of part of a block of side stolen by worker w, once it can claim no more blocks
+// When there is nothing to steal the block the worker holds on the other side is parked at other.index and the step
+// returned is not held.
+func (st *stealing) stealStep(w int, side int, other *stepScan) stepScan {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.steal(w, side) {
+		step, ok := st.slots[w][side].reserve()
+		return stepScan{step: step, held: ok}
+	}
+	if other.held {
+		st.slots[w][1-side].park(other.step.beginIndex + other.index)
 	}
 
+	return stepScan{}
+}
+
+// steal moves part of a block of side held by another worker into the slot of worker w, a parked block if there is one
+// and otherwise from the worker with the most still to reserve, false when there is nothing worth stealing
+func (st *stealing) steal(w int, side int) bool {
+	for {
+		var victim *stealSlot
+		most := 0
+		for v := range st.slots {
+			slot := &st.slots[v][side]
+			if v == w {
+				continue
+			}
+			slot.mu.Lock()
+			left := slot.stealable()
+			if st.parkedOnly && !slot.parked {
+				left = 0
+			}
+			slot.mu.Unlock()
+			if left > most {
+				victim, most = slot, left
+			}
+		}
+		if victim == nil {
+			return false
+		}
+		//The victim may have reserved what it had left since
+		if victim.stealInto(&st.slots[w][side]) {
+			return true
+		}
+	}
+}
+
+// hold makes block the block of slot, to be reserved from its start
+func (slot *stealSlot) hold(block *subListDefinition) {
+	slot.mu.Lock()
+	defer slot.mu.Unlock()
+	slot.block, slot.shared, slot.parked = block, nil, false
+	slot.next, slot.end = block.beginIndex, block.endIndex
+	slot.step = max(1, (block.endIndex-block.beginIndex+1)/stealSteps)
+}
+
+// reserve the next step of the block of slot, false once it has all been reserved
+func (slot *stealSlot) reserve() (subListDefinition, bool) {
+	slot.mu.Lock()
+	defer slot.mu.Unlock()
+	if slot.block == nil || slot.next > slot.end {
+		return subListDefinition{}, false
+	}
+	step := subListDefinition{slot.next, min(slot.next+slot.step-1, slot.end)}
+	slot.next = step.endIndex + 1
+
+	return step, true
+}
+
+// release empties slot, returning its block if this was the last part of it scanned (nil otherwise) and whether every
+// part was neutralised, failed being whether this part was left unscanned
+func (slot *stealSlot) release(failed bool) (*subListDefinition, bool) {
+	slot.mu.Lock()
+	block, shared := slot.block, slot.shared
+	slot.block, slot.shared = nil, nil
+	slot.mu.Unlock()
+
+	if block == nil || shared == nil {
+		return block, !failed
+	}
+	if failed {
+		shared.failed.Store(true)
+	}
+	if shared.parts.Add(-1) > 0 {
+		return nil, false
+	}
+
+	return block, !shared.failed.Load()
+}
+
+// park leaves the block of slot to be carried on with from index by whichever worker steals it
+func (slot *stealSlot) park(index int) {
+	slot.mu.Lock()
+	defer slot.mu.Unlock()
+	slot.next, slot.parked = index, true
+}
+
+// stealable how much of the block of slot can be stolen, everything left if parked or else what is not yet reserved
+// provided the holder would keep a step of it, 0 when none can be
+// The caller must hold slot.mu.
+func (slot *stealSlot) stealable() int {
+	left := slot.end - slot.next + 1
+	if slot.block == nil || (!slot.parked && left < 2*slot.step) {
+		return 0
+	}
+
+	return left
+}
+
+// stealInto moves what can be stolen of the block of slot into thief, false if there no longer is any
+func (slot *stealSlot) stealInto(thief *stealSlot) bool {
+	slot.mu.Lock()
+	if slot.stealable() == 0 {
+		slot.mu.Unlock()
+		return false
+	}
+	block, shared, next, end, step := slot.block, slot.shared, slot.next, slot.end, slot.step
+	if slot.parked {
+		//The parked part is handed over whole, along with its share of the block
+		slot.block, slot.shared, slot.parked = nil, nil, false
+	} else {
+		if shared == nil {
+			shared = &sharedBlock{}
+			shared.parts.Store(1)
+			slot.shared = shared
+		}
+		shared.parts.Add(1)
+		next += (end - next + 1) / 2
+		slot.end = next - 1
+	}
+	slot.mu.Unlock()
+
+	thief.mu.Lock()
+	defer thief.mu.Unlock()
+	thief.block, thief.shared, thief.parked = block, shared, false
+	thief.next, thief.end, thief.step = next, end, step
+
+	return true
+}
+
+// isDone whether done has been closed, without blocking
+func isDone(done <-chan struct{}) bool {
+	select {
+	case <-done:
+		return true
+	default:
+		return false
+	}
+}
+
+// partitionParallel partitions list[left:right+1] around pivotValue, returning the index of the first element >= pivotValue
+// The neutralise phase runs on the given number of workers (<= 0 uses GOMAXPROCS)
+func partitionParallel[T cmp.Ordered](list []T, left, right int, blockSize int, pivotValue T, workers int) int {
+	//Without a deadline the partition can't fail
+	pivotIndex, _ := partitionParallelFunc(context.Background(), list, left, right, blockSize, pivotValue, workers, cmp.Less[T], nil)
+	return pivotIndex
+}
+
+// partitionParallelFunc partitions list[left:right+1] around the pivot element as ordered by less, returning the index
+// of the first element not less than pivotValue
+// Once ctx is done no more blocks are claimed and ctx.Err() is returned, the list is left a permutation of its elements
+// Every swap of two elements is mirrored by a call to swap (unless nil), from several workers at once but never with the
+// same index on two workers.
+func partitionParallelFunc[T any](ctx context.Context, list []T, left, right int, blockSize int, pivotValue T, workers int, less func(a, b T) bool, swap func(i, j int)) (int, error) {
+	p := newSlicePartitioner(list, Options{BlockSize: blockSize, Workers: workers, swap: swap}, less)
+	p.pivotValue = pivotValue
+	return p.partition(ctx, left, right, false)
+}
+
+// blockPartition the operations partitionBlocks makes on the elements of a list, around a pivot fixed by the caller
+type blockPartition struct {
+	// neutralise neutralises a pair of blocks, called from every worker at once
+	neutralise neutraliseBlockFunc
+	// swapBlock swaps the first min(a, b) elements of blocks a and b
+	swapBlock func(a *subListDefinition, b *subListDefinition)
+	// partition sequentially partitions [left, right], returning the index of the first element not less than the pivot
+	partition func(left, right int) int
+
+	// stats (unless nil) has the rounds of every partition added to it
+	stats *Stats
+
+	// claimer, results, stealing and partial are reused by every partition
+	claimer  atomicLeftRightSubLists
+	results  []neutraliseResult
+	stealing stealing
+	partial  subListDefinition
+}
+
+// partitionBlocks partitions [left, right] as partitionParallelFunc does, the elements only touched through p
+// p must not be partitioning anything else at the same time.
+// Each round neutralises the blocks of the range and moves those left unneutralised into the middle, which the next
+// round partitions, looping rather than recursing so the stack stays the same depth however many rounds are needed.
+func partitionBlocks(ctx context.Context, p *blockPartition, left, right int, blockSize int, workers int) (int, error) {
+	rounds := 0
+	for {
+		rounds++
+		//Shared mutable
+		s := &p.claimer
+		//Ranges of billions of elements may need bigger blocks than asked for to be claimable
+		s.reset(left, right, claimableBlockSize(right-left+1, blockSize))
+		if s.length <= blockSize {
+			//Shortcut if the list is equal to or smaller than blocksize
+			p.stats.record(rounds)
+			return p.partition(left, right), nil
+		}
+
+		newLeft, newRight, err := neutraliseRound(ctx, p, left, right, workers)
+		if err != nil {
+			return 0, err
+		}
+		if newLeft > newRight {
+			p.stats.record(rounds)
+			return newLeft, nil
+		}
+		left, right = newLeft, newRight
+	}
+}
+
+// neutraliseRound one round of partitionBlocks, neutralising the blocks of [left, right] (split by p.claimer) and then
+// swapping the unneutralised ones into the middle, returning the range of the middle still to be partitioned
+// newLeft > newRight when the range is partitioned, newLeft being the index of the first element not less than the pivot
+func neutraliseRound(ctx context.Context, p *blockPartition, left, right int, workers int) (newLeft int, newRight int, err error) {
+	//Start of parallel code
+	s := &p.claimer
+	r := neutraliseBlocks(ctx, s, s.totalBlocks, workers, p.neutralise, &p.results, &p.stealing)
+	if err := ctx.Err(); err != nil {
+		return 0, 0, err
+	}
+	remainingLeftBlocks := r.remainingLeftBlocks
+	neutralisedLeftBlocks := r.neutralisedLeftBlocks
+	remainingRightBlocks := r.remainingRightBlocks
+	neutralisedRightBlocks := r.neutralisedRightBlocks
+
+	//Sequential copy of unneutralised blocks into middle
+	slices.SortFunc(remainingLeftBlocks, byBegin)
+	slices.SortFunc(neutralisedLeftBlocks, byBeginReversed)
+	swapBlock := p.swapBlock
+
 	//TODO: assuming the left blocks are all of blockSize
 	nI := 0
 	sI := 0
-	newLeft := left
+	newLeft = left
 	if len(neutralisedLeftBlocks) > 0 {
 		newLeft = neutralisedLeftBlocks[0].endIndex + 1
 	}
@@ -338,13 +1131,9 @@ func partitionParallel(list []int, left, right int, blockSize int, pivotValue in
 		sI++
 	}
 
-	sort.Slice(remainingRightBlocks, func(i, j int) bool {
-		return remainingRightBlocks[i].beginIndex > remainingRightBlocks[j].beginIndex
-	})
-	sort.Slice(neutralisedRightBlocks, func(i, j int) bool {
-		return neutralisedRightBlocks[i].beginIndex < neutralisedRightBlocks[j].beginIndex
-	})
-	newRight := right
+	slices.SortFunc(remainingRightBlocks, byBeginReversed)
+	slices.SortFunc(neutralisedRightBlocks, byBegin)
+	newRight = right
 	if len(neutralisedRightBlocks) > 0 {
 		newRight = neutralisedRightBlocks[0].beginIndex - 1
 	}
@@ -376,7 +1165,8 @@ func partitionParallel(list []int, left, right int, blockSize int, pivotValue in
 				newRight = s.beginIndex - 1
 				sI++
 			} else if uLen > nLen {
-				partialS := &SubListDefinition{s.endIndex + 1 - nLen, s.endIndex}
+				p.partial = subListDefinition{s.endIndex + 1 - nLen, s.endIndex}
+				partialS := &p.partial
 				swapBlock(partialS, n)
 				s.endIndex = partialS.beginIndex - 1
 				newRight = partialS.beginIndex
@@ -385,100 +1175,153 @@ func partitionParallel(list []int, left, right int, blockSize int, pivotValue in
 		}
 	}
 
-	if newLeft >= newRight {
-		return newLeft
-	}
+	return newLeft, newRight, nil
+}
 
-	return partitionParallel(list, newLeft, newRight, blockSize, pivotValue)
+// byBegin orders block definitions by their first index, sorting them without the allocations of sort.Slice
+func byBegin(a, b *subListDefinition) int {
+	return cmp.Compare(a.beginIndex, b.beginIndex)
 }
 
-/* sequential, part of the way to parallel
-// selectTopFaA select the top X elements of the list (inclusive)
-func selectTopFaA(list []int, top int, blockSize int) int {
-	left := 0
-	right := len(list) - 1
+// byBeginReversed orders block definitions by their first index, last first
+func byBeginReversed(a, b *subListDefinition) int {
+	return cmp.Compare(b.beginIndex, a.beginIndex)
+}
+
+// partitionStridedFunc partitions list[left:right+1] around pivotValue as ordered by less, returning the index of the
+// first element not less than pivotValue, the alternative to partitionParallelFunc selected by StridedBlocks
+// The range is dealt out round-robin in blocks of blockSize to the workers (<= 0 uses GOMAXPROCS), each of which
+// partitions its own strided sub list (as mapIndex and mapLength define it) locally. Every element before the first
+// element any worker left not less than the pivot is then known to be less than it, and every element after the last
+// element any worker left less than it is known not to be, leaving only the region between them to partition again.
+// Cancellation and swap are as for partitionParallelFunc, the splits of the workers are gathered in *splits (unless
+// nil), grown as needed and reused by each round.
+func partitionStridedFunc[T any](ctx context.Context, list []T, left, right int, blockSize int, pivotValue T, workers int, less func(a, b T) bool, swap func(i, j int), stats *Stats, splits *[]int) (int, error) {
+	rounds := 0
 	for {
-		if left == right {
-			return left
+		rounds++
+		length := right - left + 1
+		if length <= blockSize {
+			stats.record(rounds)
+			return partitionFunc(list, left, right, pivotValue, less, swap), nil
 		}
 
-		pivotIndex := left + rand.Intn(right-left+1)
-		pivotValue := list[pivotIndex]
-
-		s := NewLeftRightSubLists(list, left, right, blockSize)
+		lo, hi, err := stridedRound(ctx, list, left, right, blockSize, pivotValue, workers, less, swap, splits)
+		if err != nil {
+			return 0, err
+		}
+		if lo >= hi {
+			stats.record(rounds)
+			return lo, nil
+		}
+		if hi-lo == length {
+			//No worker narrowed the region, so partition it sequentially rather than deal it out the same way again
+			stats.record(rounds + 1)
+			return partitionFunc(list, lo, hi-1, pivotValue, less, swap), nil
+		}
+		left, right = lo, hi-1
+	}
+}
 
-		leftBlock := s.TakeNextLeft()
-		rightBlock := s.TakeNextRight()
-		lastRightBegin := rightBlock.beginIndex //TODO: assumes there are at least 2 blocks
-		i := 0
-		j := 0
-		for leftBlock != nil && rightBlock != nil {
-			lastRightBegin = rightBlock.beginIndex
+// stridedRound one round of partitionStridedFunc, partitioning the sub list of each worker and returning the misplaced
+// region [lo, hi) between their splits, every element before lo is less than pivotValue and every one from hi is not
+func stridedRound[T any](ctx context.Context, list []T, left, right int, blockSize int, pivotValue T, workers int, less func(a, b T) bool, swap func(i, j int), scratch *[]int) (lo int, hi int, err error) {
+	length := right - left + 1
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if blocks := (length + blockSize - 1) / blockSize; workers > blocks {
+		workers = blocks
+	}
 
-			fmt.Printf("before partition L: %v, R: %v, pivot index of %v, list %v\n", left, right, pivotIndex, list)
-			leftOrRight, index := neutralise(list, *leftBlock, i, *rightBlock, j, pivotValue)
-			fmt.Printf("after partition L: %v, R: %v, pivot index of %v, list %v\n", left, right, pivotIndex, list)
+	//Local partition of each worker's sub list
+	done := ctx.Done()
+	if scratch == nil {
+		scratch = new([]int)
+	}
+	if cap(*scratch) < workers {
+		*scratch = make([]int, workers)
+	}
+	splits := (*scratch)[:workers]
+	if workers == 1 {
+		splits[0] = partitionStrided(done, list, left, length, blockSize, workers, 0, pivotValue, less, swap)
+	} else {
+		partitionStridedWorkers(done, list, left, length, blockSize, splits, pivotValue, less, swap)
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, 0, err
+	}
 
-			if leftOrRight > 0 {
-				//right block, all greater than or equal to pivot (neutralised), get another
-				rightBlock = s.TakeNextRight()
-				j = 0
-				i = index
-			}
-			if leftOrRight < 0 {
-				//left block, all less than pivot (neutralised), get another
-				leftBlock = s.TakeNextLeft()
-				j = index
-				i = 0
-			}
-			if leftOrRight == 0 {
-				//both neutralised
-				rightBlock = s.TakeNextRight()
-				leftBlock = s.TakeNextLeft()
-				j = 0
-				i = 0
-			}
+	//Cleanup of the misplaced middle region
+	lo, hi = right+1, left
+	for w, split := range splits {
+		if split < mapLength(length, workers, blockSize, w) {
+			lo = min(lo, left+mapIndex(workers, blockSize, w, split))
 		}
-
-		//Sequential partition on unneutralised block
-		if leftBlock != nil {
-			pivotIndex = partition(list, leftBlock.beginIndex, leftBlock.endIndex, pivotValue)
-		} else if rightBlock != nil {
-			pivotIndex = partition(list, rightBlock.beginIndex, rightBlock.endIndex, pivotValue)
-		} else {
-			//both nil, pivot index is between them
-			pivotIndex = lastRightBegin
+		if split > 0 {
+			hi = max(hi, left+mapIndex(workers, blockSize, w, split-1)+1)
 		}
+	}
+
+	return lo, hi, nil
+}
 
-		if top == pivotIndex {
-			return pivotIndex
-		} else if top > pivotIndex {
-			for list[pivotIndex] == pivotValue {
-				if top == pivotIndex {
-					return pivotIndex
+// partitionStridedWorkers runs partitionStrided for each of len(splits) workers on its own goroutine, gathering their
+// splits, kept apart from stridedRound so that a single worker's round allocates nothing for the goroutines
+func partitionStridedWorkers[T any](done <-chan struct{}, list []T, left, length int, blockSize int, splits []int, pivotValue T, less func(a, b T) bool, swap func(i, j int)) {
+	wg := sync.WaitGroup{}
+	wg.Add(len(splits))
+	for w := range splits {
+		go func(w int) {
+			defer wg.Done()
+			splits[w] = partitionStrided(done, list, left, length, blockSize, len(splits), w, pivotValue, less, swap)
+		}(w)
+	}
+	wg.Wait()
+}
+
+// partitionStrided partitions worker pI's strided sub list of the length elements from left, returning the number of
+// its elements less than pivotValue, or stopping early (with the sub list not partitioned) once done is closed
+func partitionStrided[T any](done <-chan struct{}, list []T, left, length int, blockSize int, workers int, pI int, pivotValue T, less func(a, b T) bool, swap func(i, j int)) int {
+	//Walk the owned blocks directly rather than mapping every index, the store index follows the same blocks
+	stride := workers * blockSize
+	end := left + length
+	storeIndex := 0
+	actualStoreIndex := left + mapIndex(workers, blockSize, pI, 0)
+	for blockStart := actualStoreIndex; blockStart < end; blockStart += stride {
+		if isDone(done) {
+			return storeIndex
+		}
+		for actualI := blockStart; actualI < min(blockStart+blockSize, end); actualI++ {
+			if less(list[actualI], pivotValue) {
+				list[actualI], list[actualStoreIndex] = list[actualStoreIndex], list[actualI]
+				if swap != nil {
+					swap(actualI, actualStoreIndex)
 				}
-				pivotIndex++
-			}
-			left = pivotIndex
-		} else if top < pivotIndex {
-			for list[pivotIndex] == pivotValue {
-				if top == pivotIndex {
-					return pivotIndex
+				storeIndex++
+				actualStoreIndex++
+				if storeIndex%blockSize == 0 {
+					actualStoreIndex += stride - blockSize
 				}
-				pivotIndex--
 			}
-			right = pivotIndex
 		}
 	}
 
+	return storeIndex
+}
+
+func partition[T cmp.Ordered](list []T, left int, right int, pivotValue T) int {
+	return partitionFunc(list, left, right, pivotValue, cmp.Less[T], nil)
 }
-*/
 
-func partition(list []int, left int, right, pivotValue int) int {
+func partitionFunc[T any](list []T, left int, right int, pivotValue T, less func(a, b T) bool, swap func(i, j int)) int {
 	storeIndex := left
 	for i := left; i <= right; i++ {
-		if list[i] < pivotValue {
+		if less(list[i], pivotValue) {
 			list[i], list[storeIndex] = list[storeIndex], list[i]
+			if swap != nil {
+				swap(i, storeIndex)
+			}
 			storeIndex++
 		}
 	}
@@ -494,21 +1337,27 @@ func partition(list []int, left int, right, pivotValue int) int {
 //          where j is the index into the right sub list where the first known element < the pivotValue is
 // Case 3 - all elements in the right are greater than or equal to the pivotValue a return of 1, i is given (right is "neutralised")
 //          where i is the index into the left sub list where the first known element >= the pivotValue is
-func neutralise(list []int, left SubListDefinition, i int, right SubListDefinition, j int, pivotValue int) (leftOrRight int, index int) {
+func neutralise[T cmp.Ordered](list []T, left subListDefinition, i int, right subListDefinition, j int, pivotValue T) (leftOrRight int, index int) {
+	return neutraliseFunc(list, left, i, right, j, pivotValue, cmp.Less[T], nil)
+}
+
+// neutraliseFunc is neutralise with "less than the pivotValue" decided by less, calling swap (unless nil) with the indices
+// of every pair of elements it swaps
+func neutraliseFunc[T any](list []T, left subListDefinition, i int, right subListDefinition, j int, pivotValue T, less func(a, b T) bool, swap func(i, j int)) (leftOrRight int, index int) {
 	leftLength := left.endIndex - left.beginIndex + 1
 	rightLength := right.endIndex - right.beginIndex + 1
 
 	for i < leftLength && j < rightLength {
 		for ; i < leftLength; i++ {
 			actualI := left.beginIndex + i
-			if list[actualI] >= pivotValue {
+			if !less(list[actualI], pivotValue) {
 				break
 			}
 		}
 
 		for ; j < rightLength; j++ {
 			actualJ := right.beginIndex + j
-			if list[actualJ] < pivotValue {
+			if less(list[actualJ], pivotValue) {
 				break
 			}
 		}
@@ -520,6 +1369,9 @@ func neutralise(list []int, left SubListDefinition, i int, right SubListDefiniti
 		actualI := left.beginIndex + i
 		actualJ := right.beginIndex + j
 		list[actualI], list[actualJ] = list[actualJ], list[actualI]
+		if swap != nil {
+			swap(actualI, actualJ)
+		}
 		i++
 		j++
 	}
@@ -534,72 +1386,6 @@ func neutralise(list []int, left SubListDefinition, i int, right SubListDefiniti
 	return 1, i //right is neutralised
 }
 
-/*
-// selectTopFaA select the top X elements of the list (inclusive)
-func selectTopFaA(list []int, top int) int {
-	left := 0
-	right := len(list) - 1
-	for {
-		if left == right {
-			return left
-		}
-
-		pivotIndex := left + rand.Intn(right-left+1)
-		pivotValue := list[pivotIndex]
-		fmt.Printf("before partition L: %v, R: %v, pivot index of %v, list %v\n", left, right, pivotIndex, list)
-		pivotIndex = partition(list, SubListDefinition{left, right - 1}, SubListDefinition{right, right}, pivotValue)
-		fmt.Printf("after partition L: %v, R: %v, pivot index of %v, list %v\n", left, right, pivotIndex, list)
-
-		if top == pivotIndex {
-			return pivotIndex
-		} else if top > pivotIndex {
-			for list[pivotIndex] == pivotValue {
-				if top == pivotIndex {
-					return pivotIndex
-				}
-				pivotIndex++
-			}
-			left = pivotIndex
-		} else if top < pivotIndex {
-			for list[pivotIndex] == pivotValue {
-				if top == pivotIndex {
-					return pivotIndex
-				}
-				pivotIndex--
-			}
-			right = pivotIndex
-		}
-	}
-
-}
-
-// left and right must be disjoint
-func partition(list []int, left SubListDefinition, right SubListDefinition, pivotValue int) int {
-	subLength := (left.endIndex - left.beginIndex + 1) + (right.endIndex - right.beginIndex + 1)
-	storeIndex := 0
-
-	for i := 0; i < subLength; i++ {
-		actualI := mapIndexLR(i, left, right)
-		if list[actualI] < pivotValue {
-			actualStoreIndex := mapIndexLR(storeIndex, left, right)
-			list[actualI], list[actualStoreIndex] = list[actualStoreIndex], list[actualI]
-			storeIndex++
-		}
-	}
-
-	return mapIndexLR(storeIndex, left, right)
-}
-*/
-func mapIndexLR(i int, left SubListDefinition, right SubListDefinition) int {
-	actualI := left.beginIndex + i
-	if actualI > left.endIndex {
-		leftLength := left.endIndex - left.beginIndex + 1
-		actualI = right.beginIndex + (i - leftLength)
-	}
-
-	return actualI
-}
-
 func mapLength(length, p, b, pI int) int {
 	blocks := length / b
 	lastBlockLength := length % b
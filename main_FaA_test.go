@@ -1,10 +1,18 @@
-package main
+package topn
 
 import (
+	"cmp"
+	"context"
 	"fmt"
-	"math/rand"
+	"math"
+	"math/rand/v2"
+	"slices"
 	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -17,16 +25,32 @@ func generateList(n int) []int {
 	return list
 }
 
+// newRand a source seeded at random, along with the seed so that a failing run can be replayed
+func newRand() (*rand.Rand, uint64) {
+	seed := rand.Uint64()
+	return newSeededRand(seed), seed
+}
+
+func newSeededRand(seed uint64) *rand.Rand {
+	return rand.New(rand.NewPCG(seed, 0))
+}
+
 func Test_selectTopFaA_random(t *testing.T) {
 	n := 10 * 1000
 	b := 100
 	top := 100
 
-	list := generateList(n)
+	rng, seed := newRand()
+	list := make([]int, n)
+	for i := range list {
+		list[i] = rng.Int()
+	}
 
-	k := selectTopFaA(list, top, b)
+	k, err := selectTopFaAFunc(context.Background(), list, top, Options{BlockSize: b, Workers: 1, Rand: rng}, cmp.Less[int])
 
-	assert.Equal(t, top, k)
+	assert.NoError(t, err)
+
+	assert.Equal(t, top, k, "seed %v", seed)
 
 	actual := map[int]int{}
 	for i := 0; i < top; i++ {
@@ -43,36 +67,418 @@ func Test_selectTopFaA_random(t *testing.T) {
 		expected[v] = count + 1
 	}
 
-	assert.Equal(t, expected, actual)
+	assert.Equal(t, expected, actual, "seed %v", seed)
 }
 
-func Test_partitionParallel_allthesame(t *testing.T) {
-	list := []int{2, 4, 7, 3, 1, 9, 2, 2, 5, 2, 4}
-	pivotIndex := partitionParallel(list, 0, len(list)-1, 2, 2)
+func Test_selectTopFaA_seeded(t *testing.T) {
+	_, seed := newRand()
+	original := generateList(10 * 1000)
+
+	replays := [][]int{}
+	for i := 0; i < 3; i++ {
+		list := slices.Clone(original)
+		_, err := selectTopFaAFunc(context.Background(), list, 1234, Options{BlockSize: 10, Workers: 1, Rand: newSeededRand(seed), Pivot: SampledMedianPivot{}}, cmp.Less[int])
+		assert.NoError(t, err, "seed %v", seed)
+		replays = append(replays, list)
+	}
 
-	assert.Equal(t, []int{1, 4, 7, 3, 2, 9, 2, 2, 5, 2, 4}, list)
-	assert.Equal(t, 1, pivotIndex)
+	assert.Equal(t, replays[0], replays[1], "seed %v", seed)
+	assert.Equal(t, replays[0], replays[2], "seed %v", seed)
 }
 
-func Test_partitionParallel_remainder(t *testing.T) {
-	list := []int{1, 4, 7, 3, 2, 9, 10, 8, 5, 6, 4}
-	pivotIndex := partitionParallel(list, 0, len(list)-1, 2, 8)
+func Test_selectTopFaA_workers(t *testing.T) {
+	n := 10 * 1000
+	top := 2500
 
-	assert.Equal(t, []int{1, 4, 7, 3, 2, 4, 5, 6, 10, 8, 9}, list)
-	assert.Equal(t, 8, pivotIndex)
+	for _, workers := range []int{2, 4, 16} {
+		for _, b := range []int{1, 7, 100} {
+			list := generateList(n)
+			sorted := make([]int, n)
+			copy(sorted, list)
+			sort.Ints(sorted)
+
+			k := selectTopFaA(list, top, b, workers)
+
+			assert.Equal(t, top, k)
+			assert.Equal(t, sorted[top], list[top], "workers %v, block size %v", workers, b)
+			for i := 0; i < top; i++ {
+				if list[i] > list[top] {
+					t.Fatalf("Element at %v (%v) is greater than the selected %v. With workers %v, block size %v", i, list[i], list[top], workers, b)
+				}
+			}
+		}
+	}
 }
 
-func Test_partitionParallel(t *testing.T) {
-	list := []int{1, 4, 7, 3, 2, 9, 10, 8, 5, 6}
-	pivotIndex := partitionParallel(list, 0, len(list)-1, 2, 8)
+// orderedAs an element type the partitioning tests are instantiated over, from converting ints into it without
+// changing their order
+type orderedAs[T any] struct {
+	from func(v int) T
+	less func(a, b T) bool
+}
+
+func (as orderedAs[T]) list(values []int) []T {
+	list := make([]T, len(values))
+	for i, v := range values {
+		list[i] = as.from(v)
+	}
+	return list
+}
+
+var (
+	asInt    = orderedAs[int]{func(v int) int { return v }, cmp.Less[int]}
+	asFloat  = orderedAs[float64]{func(v int) float64 { return float64(v) / 4 }, cmp.Less[float64]}
+	asString = orderedAs[string]{func(v int) string { return fmt.Sprintf("%012d", v+1000*1000) }, cmp.Less[string]}
+	asRecord = orderedAs[logEntry]{
+		func(v int) logEntry { return logEntry{v, strconv.Itoa(v)} },
+		func(a, b logEntry) bool { return a.timestamp < b.timestamp },
+	}
+)
+
+func testPartitionParallelWorkers[T any](t *testing.T, as orderedAs[T]) {
+	n := 1000
+
+	for _, workers := range []int{0, 2, 3, 8, 64} {
+		for _, b := range []int{1, 2, 5, 33} {
+			list := make([]T, n)
+			for i := range list {
+				list[i] = as.from(rand.IntN(100))
+			}
+			pivotValue := as.from(rand.IntN(100))
+
+			pivotIndex, err := partitionParallelFunc(context.Background(), list, 0, n-1, b, pivotValue, workers, as.less, nil)
+
+			assert.NoError(t, err)
+			for i, v := range list {
+				if i < pivotIndex && !as.less(v, pivotValue) || i >= pivotIndex && as.less(v, pivotValue) {
+					t.Fatalf("Element %v at %v is on the wrong side of pivot %v at %v. With workers %v, block size %v", v, i, pivotValue, pivotIndex, workers, b)
+				}
+			}
+		}
+	}
+}
+
+func Test_partitionParallel_workers(t *testing.T) {
+	for name, test := range map[string]func(t *testing.T){
+		"int":     func(t *testing.T) { testPartitionParallelWorkers(t, asInt) },
+		"float64": func(t *testing.T) { testPartitionParallelWorkers(t, asFloat) },
+		"string":  func(t *testing.T) { testPartitionParallelWorkers(t, asString) },
+		"record":  func(t *testing.T) { testPartitionParallelWorkers(t, asRecord) },
+	} {
+		t.Run(name, test)
+	}
+}
+
+func testSelectTopFaA[T cmp.Ordered](t *testing.T, list []T, top int, b int, workers int) {
+	sorted := slices.Clone(list)
+	slices.Sort(sorted)
+
+	k := selectTopFaA(list, top, b, workers)
+
+	assert.Equal(t, top, k)
+	assert.Equal(t, sorted[top], list[top])
+	prefix := slices.Clone(list[:top])
+	slices.Sort(prefix)
+	assert.Equal(t, sorted[:top], prefix)
+}
+
+func Test_selectTopFaA_types(t *testing.T) {
+	n := 5 * 1000
+	top := 1234
+
+	for _, workers := range []int{1, 4} {
+		ints := generateList(n)
+		floats := make([]float64, n)
+		uints := make([]uint64, n)
+		durations := make([]time.Duration, n)
+		strs := make([]string, n)
+		for i, v := range ints {
+			floats[i] = float64(v) / 7
+			uints[i] = uint64(v)
+			durations[i] = time.Duration(v)
+			strs[i] = strconv.Itoa(v)
+		}
+
+		t.Run(fmt.Sprintf("int with %v workers", workers), func(t *testing.T) { testSelectTopFaA(t, ints, top, 10, workers) })
+		t.Run(fmt.Sprintf("float64 with %v workers", workers), func(t *testing.T) { testSelectTopFaA(t, floats, top, 10, workers) })
+		t.Run(fmt.Sprintf("uint64 with %v workers", workers), func(t *testing.T) { testSelectTopFaA(t, uints, top, 10, workers) })
+		t.Run(fmt.Sprintf("time.Duration with %v workers", workers), func(t *testing.T) { testSelectTopFaA(t, durations, top, 10, workers) })
+		t.Run(fmt.Sprintf("string with %v workers", workers), func(t *testing.T) { testSelectTopFaA(t, strs, top, 10, workers) })
+	}
+}
+
+func Test_selectTopFaA_NaN(t *testing.T) {
+	list := []float64{3, math.NaN(), 1, math.Inf(-1), math.NaN(), 2}
+	i := selectTopFaA(list, 2, 1, 1)
+
+	assert.Equal(t, 2, i)
+	assert.True(t, math.IsNaN(list[0]))
+	assert.True(t, math.IsNaN(list[1]))
+	assert.Equal(t, math.Inf(-1), list[2])
+}
 
-	assert.Equal(t, []int{1, 4, 7, 3, 2, 5, 6, 8, 9, 10}, list)
+type logEntry struct {
+	timestamp int
+	message   string
+}
+
+func Test_selectTopFaAFunc_records(t *testing.T) {
+	n := 5 * 1000
+	top := 321
+	less := func(a, b logEntry) bool { return a.timestamp < b.timestamp }
+
+	for _, workers := range []int{1, 4} {
+		list := make([]logEntry, n)
+		for i := range list {
+			ts := rand.IntN(n / 2)
+			list[i] = logEntry{ts, fmt.Sprintf("entry %v", i)}
+		}
+		sorted := slices.Clone(list)
+		sort.SliceStable(sorted, func(i, j int) bool { return less(sorted[i], sorted[j]) })
+
+		k, err := selectTopFaAFunc(context.Background(), list, top, Options{BlockSize: 10, Workers: workers}, less)
+
+		assert.NoError(t, err)
+
+		assert.Equal(t, top, k)
+		assert.Equal(t, sorted[top].timestamp, list[top].timestamp)
+		for i := 0; i < top; i++ {
+			if less(list[top], list[i]) {
+				t.Fatalf("Entry %v at %v is after the selected %v. With workers %v", list[i], i, list[top], workers)
+			}
+		}
+		//Records are moved whole, never copied or projected
+		messages := map[string]bool{}
+		for _, e := range list {
+			messages[e.message] = true
+		}
+		assert.Len(t, messages, n)
+	}
+}
+
+func Test_partitionParallelFunc(t *testing.T) {
+	list := []logEntry{{1, "a"}, {4, "b"}, {7, "c"}, {3, "d"}, {2, "e"}, {9, "f"}, {10, "g"}, {8, "h"}, {5, "i"}, {6, "j"}}
+	less := func(a, b logEntry) bool { return a.timestamp < b.timestamp }
+
+	pivotIndex, err := partitionParallelFunc(context.Background(), list, 0, len(list)-1, 2, logEntry{timestamp: 8}, 1, less, nil)
+
+	assert.NoError(t, err)
+
+	assert.Equal(t, []logEntry{{1, "a"}, {4, "b"}, {7, "c"}, {3, "d"}, {2, "e"}, {5, "i"}, {6, "j"}, {8, "h"}, {9, "f"}, {10, "g"}}, list)
 	assert.Equal(t, 7, pivotIndex)
 }
 
+func Test_sortFaAFunc(t *testing.T) {
+	less := func(a, b int) bool { return a < b }
+
+	for _, n := range []int{0, 1, 2, 12, 13, 100, 5000} {
+		for _, values := range []int{1, 3, n + 1} {
+			list := make([]int, n)
+			for i := range list {
+				list[i] = rand.IntN(values)
+			}
+			sorted := slices.Clone(list)
+			slices.Sort(sorted)
+
+			err := sortFaAFunc(context.Background(), list, 0, n-1, Options{BlockSize: 8, Workers: 3}, less)
+
+			assert.NoError(t, err)
+
+			assert.Equal(t, sorted, list, "n %v, values %v", n, values)
+		}
+	}
+}
+
+func Test_selectRanksFunc(t *testing.T) {
+	less := func(a, b int) bool { return a < b }
+
+	for _, n := range []int{1, 12, 13, 100, 5000} {
+		for _, values := range []int{1, 3, n + 1} {
+			for _, count := range []int{1, 2, 5, 50} {
+				list := make([]int, n)
+				for i := range list {
+					list[i] = rand.IntN(values)
+				}
+				sorted := slices.Clone(list)
+				slices.Sort(sorted)
+				ranks := make([]int, count)
+				for i := range ranks {
+					ranks[i] = rand.IntN(n)
+				}
+				slices.Sort(ranks)
+				ranks = slices.Compact(ranks)
+
+				err := selectRanksFunc(context.Background(), list, 0, n-1, ranks, Options{BlockSize: 8, Workers: 3}, less)
+
+				assert.NoError(t, err)
+				for _, rank := range ranks {
+					assert.Equal(t, sorted[rank], list[rank], "n %v, values %v, rank %v", n, values, rank)
+					assert.LessOrEqual(t, slices.Max(list[:rank+1]), list[rank], "n %v, values %v, rank %v", n, values, rank)
+					assert.GreaterOrEqual(t, slices.Min(list[rank:]), list[rank], "n %v, values %v, rank %v", n, values, rank)
+				}
+			}
+		}
+	}
+}
+
+func Test_selectRanksFunc_swap(t *testing.T) {
+	list := generateList(5000)
+	original := slices.Clone(list)
+	positions := make([]int, len(list))
+	for i := range positions {
+		positions[i] = i
+	}
+	opts := Options{BlockSize: 8, Workers: 3, swap: func(i, j int) {
+		positions[i], positions[j] = positions[j], positions[i]
+	}}
+
+	err := selectRanksFunc(context.Background(), list, 0, len(list)-1, []int{10, 2500, 4990}, opts, cmp.Less[int])
+
+	assert.NoError(t, err)
+	for i, v := range list {
+		assert.Equal(t, original[positions[i]], v)
+	}
+}
+
+func Test_partitionParallel3Func(t *testing.T) {
+	less := func(a, b int) bool { return a < b }
+
+	for _, workers := range []int{1, 4} {
+		for _, b := range []int{1, 3, 50} {
+			for _, values := range []int{1, 2, 5, 1000} {
+				list := make([]int, 1000)
+				for i := range list {
+					list[i] = rand.IntN(values)
+				}
+				//The pivot comes from the range, so the band equal to it is never empty
+				left, right := 10, 989
+				pivotValue := list[left+rand.IntN(right-left+1)]
+
+				lt, gt, err := partitionParallel3Func(context.Background(), list, left, right, b, pivotValue, workers, less, nil)
+
+				assert.NoError(t, err)
+
+				description := fmt.Sprintf("workers %v, block size %v, values %v, pivot %v, lt %v, gt %v", workers, b, values, pivotValue, lt, gt)
+				assert.True(t, left <= lt && lt < gt && gt <= right+1, description)
+				for i := left; i <= right; i++ {
+					if i < lt && list[i] >= pivotValue || i >= lt && i < gt && list[i] != pivotValue || i >= gt && list[i] <= pivotValue {
+						t.Fatalf("Element %v at %v is in the wrong band. With %v", list[i], i, description)
+					}
+				}
+			}
+		}
+	}
+}
+
+func Test_partitionStridedFunc(t *testing.T) {
+	less := func(a, b int) bool { return a < b }
+
+	for _, workers := range []int{1, 3, 4} {
+		for _, b := range []int{1, 3, 50} {
+			for _, values := range []int{1, 2, 1000} {
+				for _, length := range []int{1, 49, 1000} {
+					list := make([]int, length+20)
+					for i := range list {
+						list[i] = rand.IntN(values)
+					}
+					left, right := 10, length+9
+					pivotValue := list[left+rand.IntN(length)]
+					original := slices.Clone(list)
+					positions := make([]int, len(list))
+					for i := range positions {
+						positions[i] = i
+					}
+
+					split, err := partitionStridedFunc(context.Background(), list, left, right, b, pivotValue, workers, less, func(i, j int) {
+						positions[i], positions[j] = positions[j], positions[i]
+					}, nil, nil)
+
+					assert.NoError(t, err)
+					description := fmt.Sprintf("workers %v, block size %v, values %v, length %v, pivot %v, split %v", workers, b, values, length, pivotValue, split)
+					assert.True(t, left <= split && split <= right, description)
+					for i := left; i <= right; i++ {
+						if i < split && list[i] >= pivotValue || i >= split && list[i] < pivotValue {
+							t.Fatalf("Element %v at %v is on the wrong side. With %v", list[i], i, description)
+						}
+					}
+					assert.Equal(t, original[:left], list[:left], description)
+					assert.Equal(t, original[right+1:], list[right+1:], description)
+					for i, v := range list {
+						assert.Equal(t, original[positions[i]], v, description)
+					}
+				}
+			}
+		}
+	}
+}
+
+func Test_selectTopFaA_allthesame(t *testing.T) {
+	//One three-way round settles the whole list, the two-way partition needed a round per element
+	list := make([]int, 1000*1000)
+
+	i := selectTopFaA(list, len(list)/2, 100, 1)
+
+	assert.Equal(t, len(list)/2, i)
+}
+
+// partitionCase a partition of list around pivotValue and the list and pivot index it should give
+type partitionCase struct {
+	name       string
+	list       []int
+	left       int
+	right      int
+	blockSize  int
+	pivotValue int
+	want       []int
+	wantIndex  int
+}
+
+var partitionParallelCases = []partitionCase{
+	{"all the same", []int{2, 4, 7, 3, 1, 9, 2, 2, 5, 2, 4}, 0, 10, 2, 2, []int{1, 4, 7, 3, 2, 9, 2, 2, 5, 2, 4}, 1},
+	{"remainder", []int{1, 4, 7, 3, 2, 9, 10, 8, 5, 6, 4}, 0, 10, 2, 8, []int{1, 4, 7, 3, 2, 4, 5, 6, 10, 8, 9}, 8},
+	//The cleanup leaves a single element between the neutralised sides, which still has to be partitioned
+	{"single middle", []int{7, 8, 3, 7, 0, 5, 3, 1, 2}, 0, 8, 1, 7, []int{2, 1, 3, 3, 0, 5, 7, 8, 7}, 6},
+	{"distinct", []int{1, 4, 7, 3, 2, 9, 10, 8, 5, 6}, 0, 9, 2, 8, []int{1, 4, 7, 3, 2, 5, 6, 8, 9, 10}, 7},
+}
+
+// testPartitionCases checks partition gives each of cases as elements of type T, whose order is that of the ints
+func testPartitionCases[T any](t *testing.T, as orderedAs[T], cases []partitionCase, partition func(list []T, c partitionCase) int) {
+	for _, c := range cases {
+		list := as.list(c.list)
+
+		pivotIndex := partition(list, c)
+
+		assert.Equal(t, as.list(c.want), list, c.name)
+		assert.Equal(t, c.wantIndex, pivotIndex, c.name)
+	}
+}
+
+func testPartitionParallelCases[T any](t *testing.T, as orderedAs[T]) {
+	testPartitionCases(t, as, partitionParallelCases, func(list []T, c partitionCase) int {
+		pivotIndex, err := partitionParallelFunc(context.Background(), list, c.left, c.right, c.blockSize, as.from(c.pivotValue), 1, as.less, nil)
+		assert.NoError(t, err, c.name)
+		return pivotIndex
+	})
+}
+
+func Test_partitionParallel(t *testing.T) {
+	for name, test := range map[string]func(t *testing.T){
+		"int":     func(t *testing.T) { testPartitionParallelCases(t, asInt) },
+		"float64": func(t *testing.T) { testPartitionParallelCases(t, asFloat) },
+		"string":  func(t *testing.T) { testPartitionParallelCases(t, asString) },
+		"record":  func(t *testing.T) { testPartitionParallelCases(t, asRecord) },
+	} {
+		t.Run(name, test)
+	}
+	//The cmp.Ordered wrapper partitions as partitionParallelFunc does
+	testPartitionCases(t, asInt, partitionParallelCases, func(list []int, c partitionCase) int {
+		return partitionParallel(list, c.left, c.right, c.blockSize, c.pivotValue, 1)
+	})
+}
+
 func Test_selectTopFaA_duplicates(t *testing.T) {
 	list := []int{1, 1, 1, 1, 1, 1, 1, 1, 1, 1}
-	i := selectTopFaA(list, 5, 1)
+	i := selectTopFaA(list, 5, 1, 1)
 
 	assert.Equal(t, 5, i)
 }
@@ -80,7 +486,7 @@ func Test_selectTopFaA_duplicates(t *testing.T) {
 func Test_selectTopFaA_different(t *testing.T) {
 	//	list := []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
 	list := []int{1, 4, 7, 3, 2, 9, 10, 8, 5, 6}
-	i := selectTopFaA(list, 5, 1)
+	i := selectTopFaA(list, 5, 1, 1)
 
 	fmt.Println(i)
 	fmt.Println(list)
@@ -92,15 +498,55 @@ func Test_selectTopFaA_different(t *testing.T) {
 	assert.Equal(t, 15, sum)
 }
 
+var partitionCases = []partitionCase{
+	{"sub range", []int{1, 3, 2, 4, 7, 9, 10, 8, 5, 6}, 4, 9, 0, 8, []int{1, 3, 2, 4, 7, 5, 6, 8, 9, 10}, 7},
+}
+
+func testPartitionFuncCases[T any](t *testing.T, as orderedAs[T]) {
+	testPartitionCases(t, as, partitionCases, func(list []T, c partitionCase) int {
+		return partitionFunc(list, c.left, c.right, as.from(c.pivotValue), as.less, nil)
+	})
+}
+
 func Test_partition(t *testing.T) {
-	list := []int{1, 3, 2, 4, 7, 9, 10, 8, 5, 6}
-	left := 4
-	right := 9
+	for name, test := range map[string]func(t *testing.T){
+		"int":     func(t *testing.T) { testPartitionFuncCases(t, asInt) },
+		"float64": func(t *testing.T) { testPartitionFuncCases(t, asFloat) },
+		"string":  func(t *testing.T) { testPartitionFuncCases(t, asString) },
+		"record":  func(t *testing.T) { testPartitionFuncCases(t, asRecord) },
+	} {
+		t.Run(name, test)
+	}
+	testPartitionCases(t, asInt, partitionCases, func(list []int, c partitionCase) int {
+		return partition(list, c.left, c.right, c.pivotValue)
+	})
+}
 
-	pivotIndex := partition(list, left, right, 8)
+var claimers = map[string]func(left int, right int, blockSize int) (subListClaimer, error){
+	"mutex": func(left int, right int, blockSize int) (subListClaimer, error) {
+		s, err := newLeftRightSubLists(left, right, blockSize)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	},
+	"atomic": func(left int, right int, blockSize int) (subListClaimer, error) {
+		s, err := newAtomicLeftRightSubLists(left, right, blockSize)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	},
+}
 
-	assert.Equal(t, []int{1, 3, 2, 4, 7, 5, 6, 8, 9, 10}, list)
-	assert.Equal(t, 7, pivotIndex)
+func TestTakeLeftRight_invalidBlockSize(t *testing.T) {
+	for claimerName, newClaimer := range claimers {
+		for _, b := range []int{0, -1} {
+			_, err := newClaimer(0, 9, b)
+
+			assert.ErrorIs(t, err, ErrInvalidBlockSize, "%v claimer with block size %v", claimerName, b)
+		}
+	}
 }
 
 func TestTakeLeftRight(t *testing.T) {
@@ -147,44 +593,289 @@ func TestTakeLeftRight(t *testing.T) {
 	}
 
 	for _, c := range cases {
-		for listI, list := range lists {
-			for _, leftRight := range leftRightCombos {
-				left := leftRight.left
-				right := leftRight.right
-
-				for b := 1; b <= len(list); b++ {
-					t.Run(fmt.Sprintf("Running case %v with block size of %v with left %v and right %v for list at index %v", c.takePattern, b, left, right, listI), func(t *testing.T) {
-						s := NewLeftRightSubLists(list, left, right, b)
-
-						output := make([]int, len(list))
-						bLeft := s.TakeNextLeft()
-						bRight := s.TakeNextRight()
-						for bLeft != nil || bRight != nil {
-							if bLeft != nil {
-								for i := bLeft.beginIndex; i <= bLeft.endIndex; i++ {
-									if output[i] != 0 {
-										t.Errorf("Output at index %v has already been set! On left %v", i, bLeft)
+		for claimerName, newClaimer := range claimers {
+			for listI, list := range lists {
+				for _, leftRight := range leftRightCombos {
+					left := leftRight.left
+					right := leftRight.right
+
+					for b := 1; b <= len(list); b++ {
+						t.Run(fmt.Sprintf("Running case %v on %v with block size of %v with left %v and right %v for list at index %v", c.takePattern, claimerName, b, left, right, listI), func(t *testing.T) {
+							s, err := newClaimer(left, right, b)
+							assert.NoError(t, err)
+
+							output := make([]int, len(list))
+							bLeft := s.TakeNextLeft()
+							bRight := s.TakeNextRight()
+							for bLeft != nil || bRight != nil {
+								if bLeft != nil {
+									for i := bLeft.beginIndex; i <= bLeft.endIndex; i++ {
+										if output[i] != 0 {
+											t.Errorf("Output at index %v has already been set! On left %v", i, bLeft)
+										}
+										output[i] = list[i]
 									}
-									output[i] = list[i]
 								}
-							}
-							if bRight != nil {
-								for i := bRight.beginIndex; i <= bRight.endIndex; i++ {
-									if output[i] != 0 {
-										t.Errorf("Output at index %v has already been set! On right %v", i, bRight)
+								if bRight != nil {
+									for i := bRight.beginIndex; i <= bRight.endIndex; i++ {
+										if output[i] != 0 {
+											t.Errorf("Output at index %v has already been set! On right %v", i, bRight)
+										}
+										output[i] = list[i]
 									}
-									output[i] = list[i]
 								}
+
+								bLeft = s.TakeNextLeft()
+								bRight = s.TakeNextRight()
 							}
 
-							bLeft = s.TakeNextLeft()
-							bRight = s.TakeNextRight()
+							assert.Equal(t, list, output, "Output list did not match input list")
+						})
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestTakeLeftRight_concurrent(t *testing.T) {
+	n := 10 * 1000
+	goroutines := 16
+
+	for claimerName, newClaimer := range claimers {
+		for _, b := range []int{1, 3, 64} {
+			s, err := newClaimer(0, n-1, b)
+			assert.NoError(t, err)
+
+			owner := make([]int32, n)
+			wg := sync.WaitGroup{}
+			wg.Add(goroutines)
+			for g := 0; g < goroutines; g++ {
+				go func() {
+					defer wg.Done()
+					for {
+						var block *subListDefinition
+						if rand.IntN(2) == 0 {
+							block = s.TakeNextLeft()
+						} else {
+							block = s.TakeNextRight()
+						}
+						if block == nil {
+							return
 						}
+						for i := block.beginIndex; i <= block.endIndex; i++ {
+							atomic.AddInt32(&owner[i], 1)
+						}
+					}
+				}()
+			}
+			wg.Wait()
 
-						assert.Equal(t, list, output, "Output list did not match input list")
-					})
+			for i, owned := range owner {
+				if owned != 1 {
+					t.Fatalf("Index %v was claimed %v times on %v with block size of %v", i, owned, claimerName, b)
 				}
 			}
 		}
 	}
 }
+
+func Test_atomicLeftRightSubLists_claimableBlocks(t *testing.T) {
+	if math.MaxInt == math.MaxInt32 {
+		t.Skip("an int can't index more blocks than can be claimed")
+	}
+	var claimable uint64 = maxClaimableBlocks
+	length := int(claimable) + 1
+
+	assert.Panics(t, func() { newAtomicLeftRightSubLists(0, length-1, 1) })
+	s, err := newAtomicLeftRightSubLists(0, length-1, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, int(claimable/2)+1, s.totalBlocks)
+	assert.Equal(t, &subListDefinition{length - 2, length - 1}, s.TakeNextRight())
+	assert.Equal(t, &subListDefinition{0, 1}, s.TakeNextLeft())
+
+	assert.Equal(t, 2, claimableBlockSize(length, 1))
+	assert.Equal(t, 1, claimableBlockSize(length-1, 1))
+	assert.Equal(t, 64, claimableBlockSize(length, 64))
+	assert.Equal(t, 1, claimableBlockSize(0, 1))
+}
+
+func Test_neutraliseBlocks_stealing(t *testing.T) {
+	n := 10 * 1000
+	for _, b := range []int{1, 3, 64} {
+		for _, workers := range []int{2, 4, 16} {
+			list := make([]int, n)
+			for i := range list {
+				//Skewed so that the workers run out of one side unevenly
+				list[i] = rand.IntN(100) * rand.IntN(100)
+			}
+			pivotValue := 2500
+			s, err := newAtomicLeftRightSubLists(0, n-1, b)
+			assert.NoError(t, err)
+			neutralise := func(l subListDefinition, i int, r subListDefinition, j int) (int, int) {
+				return neutraliseFunc(list, l, i, r, j, pivotValue, cmp.Less[int], nil)
+			}
+			var results []neutraliseResult
+			var st stealing
+
+			r := neutraliseBlocks(context.Background(), s, s.totalBlocks, workers, neutralise, &results, &st)
+
+			description := fmt.Sprintf("block size %v workers %v", b, workers)
+			assert.True(t, len(r.remainingLeftBlocks) == 0 || len(r.remainingRightBlocks) == 0,
+				"Unneutralised blocks on both sides, left %v right %v. With %v", r.remainingLeftBlocks, r.remainingRightBlocks, description)
+			owner := make([]int, n)
+			for _, blocks := range [][]*subListDefinition{r.remainingLeftBlocks, r.neutralisedLeftBlocks, r.remainingRightBlocks, r.neutralisedRightBlocks} {
+				for _, block := range blocks {
+					for i := block.beginIndex; i <= block.endIndex; i++ {
+						owner[i]++
+					}
+				}
+			}
+			for i, owned := range owner {
+				if owned != 1 {
+					t.Fatalf("Index %v is in %v blocks. With %v", i, owned, description)
+				}
+			}
+			for _, block := range r.neutralisedLeftBlocks {
+				assert.True(t, isNeutralised(list[block.beginIndex:block.endIndex+1], pivotValue, -1, cmp.Less[int]), description)
+			}
+			for _, block := range r.neutralisedRightBlocks {
+				assert.True(t, isNeutralised(list[block.beginIndex:block.endIndex+1], pivotValue, 1, cmp.Less[int]), description)
+			}
+		}
+	}
+}
+
+func Test_neutraliseBlocks_stealsTail(t *testing.T) {
+	//Left blocks [0, 32) all less than the pivot and right blocks [32, 64) all not, so only the time taken varies
+	n, b := 64, 16
+	list := make([]int, n)
+	for i := range list {
+		list[i] = i
+	}
+	pivotValue := n / 2
+	s, err := newAtomicLeftRightSubLists(0, n-1, b)
+	assert.NoError(t, err)
+
+	//The first worker to start on a left block stalls until the other, having run out of blocks, steals the back half
+	//of it, without stealing the tail is left to the stalled worker alone and neither ever finishes
+	var stalledBlock atomic.Int64
+	stalledBlock.Store(-1)
+	stolen := make(chan struct{})
+	var closeStolen sync.Once
+	neutralise := func(l subListDefinition, i int, r subListDefinition, j int) (int, int) {
+		block := int64(l.beginIndex / b)
+		if l.beginIndex%b == 0 && stalledBlock.CompareAndSwap(-1, block) {
+			<-stolen
+		} else if block == stalledBlock.Load() && l.beginIndex%b >= b/2 {
+			closeStolen.Do(func() { close(stolen) })
+		}
+		return neutraliseFunc(list, l, i, r, j, pivotValue, cmp.Less[int], nil)
+	}
+	var results []neutraliseResult
+	var st stealing
+	finished := make(chan *neutraliseResult)
+
+	go func() {
+		finished <- neutraliseBlocks(context.Background(), s, s.totalBlocks, 2, neutralise, &results, &st)
+	}()
+
+	<-stolen
+	r := <-finished
+	assert.Len(t, r.neutralisedLeftBlocks, 2)
+	assert.Len(t, r.neutralisedRightBlocks, 2)
+	assert.Empty(t, r.remainingLeftBlocks)
+	assert.Empty(t, r.remainingRightBlocks)
+}
+
+func Test_neutraliseResult_join(t *testing.T) {
+	blocks := []*subListDefinition{{0, 1}, {2, 3}, {4, 5}, {6, 7}, {8, 9}}
+	rs := []neutraliseResult{
+		{neutralisedLeftBlocks: blocks[:1], remainingRightBlocks: blocks[4:]},
+		{neutralisedLeftBlocks: blocks[1:2], remainingLeftBlocks: blocks[2:3], neutralisedRightBlocks: blocks[3:4]},
+	}
+	var joined neutraliseResult
+
+	joined.join(rs)
+
+	assert.Equal(t, blocks[2:3], joined.remainingLeftBlocks)
+	assert.Equal(t, blocks[:2], joined.neutralisedLeftBlocks)
+	assert.Equal(t, blocks[4:], joined.remainingRightBlocks)
+	assert.Equal(t, blocks[3:4], joined.neutralisedRightBlocks)
+	//One backing array holds every block, rather than each list having room for all of them
+	assert.Equal(t, len(blocks), cap(joined.backing))
+}
+
+func Test_stealSlot(t *testing.T) {
+	block := &subListDefinition{0, 15}
+	var victim, thief, adopter stealSlot
+	victim.hold(block)
+
+	step, ok := victim.reserve()
+	assert.True(t, ok)
+	assert.Equal(t, subListDefinition{0, 3}, step)
+
+	//The back half of the 12 elements not yet reserved is stolen
+	assert.True(t, victim.stealInto(&thief))
+	assert.Equal(t, 10, thief.next)
+	assert.Equal(t, 15, thief.end)
+	assert.Equal(t, 9, victim.end)
+	step, _ = victim.reserve()
+	assert.Equal(t, subListDefinition{4, 7}, step)
+	//Too little is left to be worth stealing
+	assert.False(t, victim.stealInto(&adopter))
+
+	//The thief stops part way through its step, which is parked and carried on with by another worker
+	step, _ = thief.reserve()
+	assert.Equal(t, subListDefinition{10, 13}, step)
+	thief.park(step.beginIndex + 2)
+	assert.True(t, thief.stealInto(&adopter))
+	assert.Equal(t, 12, adopter.next)
+	assert.Equal(t, 15, adopter.end)
+	assert.Nil(t, thief.block)
+
+	//The block is only recorded by the last part released, and only neutralised if every part was scanned
+	released, _ := victim.release(false)
+	assert.Nil(t, released)
+	released, neutralised := adopter.release(false)
+	assert.Equal(t, block, released)
+	assert.True(t, neutralised)
+
+	victim.hold(block)
+	victim.reserve()
+	assert.True(t, victim.stealInto(&thief))
+	released, _ = thief.release(true)
+	assert.Nil(t, released)
+	released, neutralised = victim.release(false)
+	assert.Equal(t, block, released)
+	assert.False(t, neutralised)
+}
+
+func BenchmarkTakeLeftRight(b *testing.B) {
+	n := 64 * 1024
+
+	for _, claimerName := range []string{"mutex", "atomic"} {
+		newClaimer := claimers[claimerName]
+		for goroutines := 1; goroutines <= 64; goroutines *= 2 {
+			b.Run(fmt.Sprintf("%v/goroutines-%v", claimerName, goroutines), func(b *testing.B) {
+				for k := 0; k < b.N; k++ {
+					s, err := newClaimer(0, n-1, 1)
+					if err != nil {
+						b.Fatal(err)
+					}
+
+					wg := sync.WaitGroup{}
+					wg.Add(goroutines)
+					for g := 0; g < goroutines; g++ {
+						go func() {
+							defer wg.Done()
+							for s.TakeNextLeft() != nil && s.TakeNextRight() != nil {
+							}
+						}()
+					}
+					wg.Wait()
+				}
+			})
+		}
+	}
+}
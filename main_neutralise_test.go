@@ -1,21 +1,22 @@
-package main
+package topn
 
 import (
+	"cmp"
 	"fmt"
 	"math"
-	"math/rand"
+	"math/rand/v2"
 	"reflect"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 )
 
-func isNeutralised(list []int, pivotValue int, leftOrRight int) bool {
+func isNeutralised[T any](list []T, pivotValue T, leftOrRight int, less func(a, b T) bool) bool {
 	for _, v := range list {
-		if (leftOrRight == 0 || leftOrRight == -1) && v >= pivotValue {
+		if (leftOrRight == 0 || leftOrRight == -1) && !less(v, pivotValue) {
 			return false
 		}
-		if (leftOrRight == 0 || leftOrRight == 1) && v < pivotValue {
+		if (leftOrRight == 0 || leftOrRight == 1) && less(v, pivotValue) {
 			return false
 		}
 	}
@@ -24,10 +25,29 @@ func isNeutralised(list []int, pivotValue int, leftOrRight int) bool {
 }
 
 type LeftRight struct {
-	left, right SubListDefinition
+	left, right subListDefinition
 }
 
 func Test_neutralise(t *testing.T) {
+	for name, test := range map[string]func(t *testing.T){
+		"int":     func(t *testing.T) { testNeutralise(t, asInt) },
+		"float64": func(t *testing.T) { testNeutralise(t, asFloat) },
+		"string":  func(t *testing.T) { testNeutralise(t, asString) },
+		"record":  func(t *testing.T) { testNeutralise(t, asRecord) },
+	} {
+		t.Run(name, test)
+	}
+
+	//The cmp.Ordered wrapper neutralises as neutraliseFunc does
+	list, want := []int{3, 1, 2, 0}, []int{3, 1, 2, 0}
+	leftOrRight, index := neutralise(list, subListDefinition{0, 1}, 0, subListDefinition{2, 3}, 0, 2)
+	wantLeftOrRight, wantIndex := neutraliseFunc(want, subListDefinition{0, 1}, 0, subListDefinition{2, 3}, 0, 2, cmp.Less[int], nil)
+	assert.Equal(t, want, list)
+	assert.Equal(t, wantLeftOrRight, leftOrRight)
+	assert.Equal(t, wantIndex, index)
+}
+
+func testNeutralise[T any](t *testing.T, as orderedAs[T]) {
 	shuffles := 10
 	lists := [][]int{
 		[]int{1, 2},
@@ -45,8 +65,8 @@ func Test_neutralise(t *testing.T) {
 
 				for rightLength := 1; rightLength+leftLength <= len(originalList); rightLength++ {
 					for rightI := leftEndIndex + 1; rightI+rightLength <= len(originalList)-1; rightI++ {
-						left := SubListDefinition{leftI, leftEndIndex}
-						right := SubListDefinition{rightI, rightI + rightLength - 1}
+						left := subListDefinition{leftI, leftEndIndex}
+						right := subListDefinition{rightI, rightI + rightLength - 1}
 						leftRights = append(leftRights, LeftRight{left, right})
 					}
 				}
@@ -72,23 +92,23 @@ func Test_neutralise(t *testing.T) {
 			right := leftRight.right
 			for pivotValue := range pivotValues {
 				for i := 0; i < shuffles; i++ {
-					list := make([]int, len(originalList))
-					copy(list, originalList)
+					list := as.list(originalList)
 					Shuffle(list)
+					pivot := as.from(pivotValue)
 
-					caseDescription := fmt.Sprintf("Pivot Value %v, left %v, right %v, list %v", pivotValue, left, right, list)
-					leftOrRight, index := neutralise(list, left, 0, right, 0, pivotValue)
+					caseDescription := fmt.Sprintf("Pivot Value %v, left %v, right %v, list %v", pivot, left, right, list)
+					leftOrRight, index := neutraliseFunc(list, left, 0, right, 0, pivot, as.less, nil)
 					caseDescription = fmt.Sprintf("%v, LorR %v, index %v, new list %v", caseDescription, leftOrRight, index, list)
 
 					if leftOrRight == -1 {
-						assert.True(t, isNeutralised(list[left.beginIndex:left.endIndex+1], pivotValue, -1), caseDescription)
-						assert.True(t, isNeutralised(list[right.beginIndex:right.beginIndex+index], pivotValue, 1), caseDescription)
+						assert.True(t, isNeutralised(list[left.beginIndex:left.endIndex+1], pivot, -1, as.less), caseDescription)
+						assert.True(t, isNeutralised(list[right.beginIndex:right.beginIndex+index], pivot, 1, as.less), caseDescription)
 					} else if leftOrRight == 1 {
-						assert.True(t, isNeutralised(list[right.beginIndex:right.endIndex+1], pivotValue, 1), caseDescription)
-						assert.True(t, isNeutralised(list[left.beginIndex:left.beginIndex+index], pivotValue, -1), caseDescription)
+						assert.True(t, isNeutralised(list[right.beginIndex:right.endIndex+1], pivot, 1, as.less), caseDescription)
+						assert.True(t, isNeutralised(list[left.beginIndex:left.beginIndex+index], pivot, -1, as.less), caseDescription)
 					} else {
-						assert.True(t, isNeutralised(list[left.beginIndex:left.endIndex+1], pivotValue, -1), caseDescription)
-						assert.True(t, isNeutralised(list[right.beginIndex:right.endIndex+1], pivotValue, 1), caseDescription)
+						assert.True(t, isNeutralised(list[left.beginIndex:left.endIndex+1], pivot, -1, as.less), caseDescription)
+						assert.True(t, isNeutralised(list[right.beginIndex:right.endIndex+1], pivot, 1, as.less), caseDescription)
 					}
 				}
 			}
@@ -101,7 +121,7 @@ func Shuffle(slice interface{}) {
 	swap := reflect.Swapper(slice)
 	length := rv.Len()
 	for i := length - 1; i > 0; i-- {
-		j := rand.Intn(i + 1)
+		j := rand.IntN(i + 1)
 		swap(i, j)
 	}
 }
@@ -0,0 +1,105 @@
+package topn
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"testing"
+)
+
+// oracleCase a random list, its sorted copy and the block size and workers to select or partition it with, all drawn
+// from seed so a failure can be replayed
+type oracleCase struct {
+	seed      uint64
+	list      []int
+	sorted    []int
+	blockSize int
+	workers   int
+}
+
+func newOracleCase(seed uint64) oracleCase {
+	rng := newSeededRand(seed)
+	length := 1 + rng.IntN(5000)
+	//From all the same to all distinct
+	values := 1 + rng.IntN(2*length)
+	list := make([]int, length)
+	for i := range list {
+		list[i] = rng.IntN(values)
+	}
+	sorted := slices.Clone(list)
+	slices.Sort(sorted)
+	blockSizes := []int{1, 2, 3, 7, 16, 64, 1000, length}
+
+	return oracleCase{
+		seed:      seed,
+		list:      list,
+		sorted:    sorted,
+		blockSize: blockSizes[rng.IntN(len(blockSizes))],
+		workers:   1 + rng.IntN(8),
+	}
+}
+
+func (c oracleCase) String() string {
+	return fmt.Sprintf("seed %v, length %v, block size %v, workers %v", c.seed, len(c.list), c.blockSize, c.workers)
+}
+
+// checkPermutation fails unless list holds exactly the elements of the sorted oracle
+func (c oracleCase) checkPermutation(t *testing.T, list []int) {
+	t.Helper()
+	got := slices.Clone(list)
+	slices.Sort(got)
+	if !slices.Equal(c.sorted, got) {
+		t.Fatalf("The list is no longer a permutation of the input. With %v", c)
+	}
+}
+
+func Test_selectTopFaA_oracle(t *testing.T) {
+	for seed := uint64(0); seed < 500; seed++ {
+		c := newOracleCase(seed)
+		list := slices.Clone(c.list)
+		top := newSeededRand(seed).IntN(len(list))
+
+		k := selectTopFaA(list, top, c.blockSize, c.workers)
+
+		if k != top {
+			t.Fatalf("Returned %v selecting %v. With %v", k, top, c)
+		}
+		if list[top] != c.sorted[top] {
+			t.Fatalf("Selected %v at %v, the oracle has %v. With %v", list[top], top, c.sorted[top], c)
+		}
+		for i, v := range list {
+			if i < top && v > list[top] || i > top && v < list[top] {
+				t.Fatalf("Element %v at %v is on the wrong side of %v at %v. With %v", v, i, list[top], top, c)
+			}
+		}
+		c.checkPermutation(t, list)
+	}
+}
+
+func Test_partitionParallel_oracle(t *testing.T) {
+	for seed := uint64(0); seed < 500; seed++ {
+		c := newOracleCase(seed)
+		list := slices.Clone(c.list)
+		rng := newSeededRand(seed)
+		left := rng.IntN(len(list))
+		right := left + rng.IntN(len(list)-left)
+		pivotValue := list[left+rng.IntN(right-left+1)]
+		inRange := slices.Clone(list[left : right+1])
+		slices.Sort(inRange)
+
+		pivotIndex := partitionParallel(list, left, right, c.blockSize, pivotValue, c.workers)
+
+		if want := left + sort.SearchInts(inRange, pivotValue); pivotIndex != want {
+			t.Fatalf("Returned %v partitioning [%v, %v] around %v, the oracle has %v. With %v", pivotIndex, left, right, pivotValue, want, c)
+		}
+		for i := left; i <= right; i++ {
+			if i < pivotIndex && list[i] >= pivotValue || i >= pivotIndex && list[i] < pivotValue {
+				t.Fatalf("Element %v at %v is on the wrong side of %v. With %v", list[i], i, pivotIndex, c)
+			}
+		}
+		if !slices.Equal(c.list[:left], list[:left]) || !slices.Equal(c.list[right+1:], list[right+1:]) {
+			t.Fatalf("Elements outside [%v, %v] moved. With %v", left, right, c)
+		}
+		c.checkPermutation(t, list)
+	}
+}
@@ -0,0 +1,194 @@
+package topn
+
+import (
+	"math/rand/v2"
+	"sort"
+)
+
+// DefaultSampleSize the sample size used by SampledMedianPivot and FloydRivestPivot when SampleSize is not set
+const DefaultSampleSize = 64
+
+// PivotStrategy chooses the element each round of a selection (or sort) partitions around
+type PivotStrategy interface {
+	// Pivot returns the index in [left, right] of the pivot element, less(i, j) compares the elements at indices i and
+	// j and rank is the index being selected, any randomness must come from rng so that seeded selections replay exactly
+	Pivot(rng *rand.Rand, less func(i, j int) bool, left, right, rank int) int
+}
+
+// RandomPivot picks an element uniformly at random, the default
+type RandomPivot struct{}
+
+func (RandomPivot) Pivot(rng *rand.Rand, less func(i, j int) bool, left, right, rank int) int {
+	return left + rng.IntN(right-left+1)
+}
+
+// MedianOfThreePivot picks the median of the first, middle and last elements, deterministic and good on presorted data
+type MedianOfThreePivot struct{}
+
+func (MedianOfThreePivot) Pivot(rng *rand.Rand, less func(i, j int) bool, left, right, rank int) int {
+	return medianOfThree(less, left, left+(right-left)/2, right)
+}
+
+// NintherPivot picks Tukey's ninther, the median of the medians of three groups of three spread across the range
+type NintherPivot struct{}
+
+func (NintherPivot) Pivot(rng *rand.Rand, less func(i, j int) bool, left, right, rank int) int {
+	length := right - left + 1
+	if length < 9 {
+		return medianOfThree(less, left, left+(right-left)/2, right)
+	}
+
+	step := length / 8
+	middle := left + (right-left)/2
+	return medianOfThree(less,
+		medianOfThree(less, left, left+step, left+2*step),
+		medianOfThree(less, middle-step, middle, middle+step),
+		medianOfThree(less, right-2*step, right-step, right),
+	)
+}
+
+// SampledMedianPivot picks the median of a random sample of SampleSize elements (<= 0 uses DefaultSampleSize)
+type SampledMedianPivot struct {
+	SampleSize int
+}
+
+func (p SampledMedianPivot) Pivot(rng *rand.Rand, less func(i, j int) bool, left, right, rank int) int {
+	sample := sortedSample(rng, less, left, right, p.SampleSize)
+	return sample[len(sample)/2]
+}
+
+// FloydRivestPivot picks from a random sample of SampleSize elements (<= 0 uses DefaultSampleSize) the one whose rank in
+// the sample matches the position of rank in the range, so the pivot lands close to the element being selected and
+// most of the range is discarded each round
+type FloydRivestPivot struct {
+	SampleSize int
+}
+
+func (p FloydRivestPivot) Pivot(rng *rand.Rand, less func(i, j int) bool, left, right, rank int) int {
+	sample := sortedSample(rng, less, left, right, p.SampleSize)
+	sampleRank := (rank - left) * len(sample) / (right - left + 1)
+	return sample[sampleRank]
+}
+
+// MedianOfMediansPivot picks the median of the medians of groups of five elements, found by recursing on the medians
+// At least 3/10 of the range is on each side of the pivot, so selection with it is linear in the worst case, but the
+// constant is large and it works on a copy of the range's indices (allocated for each pivot, except by a Selector).
+// Selections fall back to it on their own when other strategies stop making progress.
+type MedianOfMediansPivot struct {
+	// indices (unless nil) the scratch the copy of the indices is made in, grown as needed
+	indices *[]int
+}
+
+func (p MedianOfMediansPivot) Pivot(rng *rand.Rand, less func(i, j int) bool, left, right, rank int) int {
+	var indices []int
+	if p.indices == nil {
+		indices = make([]int, right-left+1)
+	} else {
+		if cap(*p.indices) < right-left+1 {
+			*p.indices = make([]int, right-left+1)
+		}
+		indices = (*p.indices)[:right-left+1]
+	}
+	for i := range indices {
+		indices[i] = left + i
+	}
+
+	return medianOfMedians(less, indices)
+}
+
+// medianOfMedians the index of the median of the medians of the groups of five of indices, indices is reordered
+func medianOfMedians(less func(i, j int) bool, indices []int) int {
+	if len(indices) <= 5 {
+		insertionSortIndices(less, indices)
+		return indices[len(indices)/2]
+	}
+
+	//Gather the median of each group at the front
+	medians := 0
+	for g := 0; g < len(indices); g += 5 {
+		group := indices[g:min(g+5, len(indices))]
+		insertionSortIndices(less, group)
+		indices[medians], group[len(group)/2] = group[len(group)/2], indices[medians]
+		medians++
+	}
+
+	return selectIndex(less, indices[:medians], medians/2)
+}
+
+// selectIndex the index of the element of rank k amongst indices, using median of medians pivots, indices is reordered
+func selectIndex(less func(i, j int) bool, indices []int, k int) int {
+	for len(indices) > 5 {
+		pivot := medianOfMedians(less, indices)
+
+		//Three way partition of indices around the pivot element
+		lt, i, gt := 0, 0, len(indices)
+		for i < gt {
+			if less(indices[i], pivot) {
+				indices[lt], indices[i] = indices[i], indices[lt]
+				lt++
+				i++
+			} else if less(pivot, indices[i]) {
+				gt--
+				indices[i], indices[gt] = indices[gt], indices[i]
+			} else {
+				i++
+			}
+		}
+
+		if k < lt {
+			indices = indices[:lt]
+		} else if k < gt {
+			return indices[k]
+		} else {
+			indices = indices[gt:]
+			k -= gt
+		}
+	}
+
+	insertionSortIndices(less, indices)
+	return indices[k]
+}
+
+func insertionSortIndices(less func(i, j int) bool, indices []int) {
+	for i := 1; i < len(indices); i++ {
+		for j := i; j > 0 && less(indices[j], indices[j-1]); j-- {
+			indices[j], indices[j-1] = indices[j-1], indices[j]
+		}
+	}
+}
+
+// medianOfThree the index of the median of the elements at a, b and c
+func medianOfThree(less func(i, j int) bool, a, b, c int) int {
+	if less(b, a) {
+		a, b = b, a
+	}
+	//a <= b, so the median is b unless c is below it
+	if less(c, b) {
+		if less(c, a) {
+			return a
+		}
+		return c
+	}
+
+	return b
+}
+
+// sortedSample the indices of a random sample (with replacement) of size elements from [left, right], ordered by less
+func sortedSample(rng *rand.Rand, less func(i, j int) bool, left, right, size int) []int {
+	if size <= 0 {
+		size = DefaultSampleSize
+	}
+	if length := right - left + 1; size > length {
+		size = length
+	}
+
+	sample := make([]int, size)
+	for i := range sample {
+		sample[i] = left + rng.IntN(right-left+1)
+	}
+	sort.Slice(sample, func(i, j int) bool {
+		return less(sample[i], sample[j])
+	})
+
+	return sample
+}
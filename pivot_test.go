@@ -0,0 +1,239 @@
+package topn
+
+import (
+	"fmt"
+	"math/bits"
+	"math/rand/v2"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var pivotStrategies = map[string]PivotStrategy{
+	"random":              RandomPivot{},
+	"median of three":     MedianOfThreePivot{},
+	"ninther":             NintherPivot{},
+	"sampled median":      SampledMedianPivot{},
+	"sampled median of 5": SampledMedianPivot{SampleSize: 5},
+	"floyd rivest":        FloydRivestPivot{},
+	"floyd rivest of 500": FloydRivestPivot{SampleSize: 500},
+	"median of medians":   MedianOfMediansPivot{},
+}
+
+// pivotDataSets the layouts that make naive pivot choices go wrong
+var pivotDataSets = map[string]func(n int) []int{
+	"random": generateList,
+	"sorted": func(n int) []int {
+		list := make([]int, n)
+		for i := range list {
+			list[i] = i
+		}
+		return list
+	},
+	"reversed": func(n int) []int {
+		list := make([]int, n)
+		for i := range list {
+			list[i] = n - i
+		}
+		return list
+	},
+	"organ pipe": func(n int) []int {
+		list := make([]int, n)
+		for i := range list {
+			list[i] = min(i, n-i)
+		}
+		return list
+	},
+	"few values": func(n int) []int {
+		list := make([]int, n)
+		for i := range list {
+			list[i] = rand.IntN(3)
+		}
+		return list
+	},
+	"all the same": func(n int) []int {
+		return make([]int, n)
+	},
+}
+
+func TestPivotStrategies(t *testing.T) {
+	for strategyName, strategy := range pivotStrategies {
+		for dataName, generate := range pivotDataSets {
+			for _, n := range []int{1, 2, 10, 3001} {
+				for _, sorted := range []bool{false, true} {
+					t.Run(fmt.Sprintf("%v on %v of %v sorted %v", strategyName, dataName, n, sorted), func(t *testing.T) {
+						list := generate(n)
+						expected := slices.Clone(list)
+						slices.Sort(expected)
+						top := rand.IntN(n)
+
+						_, err := SelectTopN(list, top, Options{BlockSize: 16, Workers: 2, Pivot: strategy, Sorted: sorted})
+
+						assert.NoError(t, err)
+						assert.Equal(t, expected[top], list[top])
+						if sorted {
+							assert.Equal(t, expected[:top+1], list[:top+1])
+						} else {
+							prefix := slices.Clone(list[:top])
+							slices.Sort(prefix)
+							assert.Equal(t, expected[:top], prefix)
+						}
+					})
+				}
+			}
+		}
+	}
+}
+
+func TestPivotStrategies_inRange(t *testing.T) {
+	list := generateList(200)
+	less := func(i, j int) bool { return list[i] < list[j] }
+	rng, _ := newRand()
+
+	for strategyName, strategy := range pivotStrategies {
+		for k := 0; k < 1000; k++ {
+			left := rand.IntN(len(list))
+			right := left + rand.IntN(len(list)-left)
+			rank := left + rand.IntN(right-left+1)
+
+			pivot := strategy.Pivot(rng, less, left, right, rank)
+
+			if pivot < left || pivot > right {
+				t.Fatalf("%v picked %v outside of [%v, %v]", strategyName, pivot, left, right)
+			}
+		}
+	}
+}
+
+func Test_medianOfThree(t *testing.T) {
+	for _, list := range [][]int{{1, 2, 3}, {1, 3, 2}, {2, 1, 3}, {2, 3, 1}, {3, 1, 2}, {3, 2, 1}, {1, 1, 2}, {2, 1, 1}, {1, 1, 1}} {
+		less := func(i, j int) bool { return list[i] < list[j] }
+
+		median := medianOfThree(less, 0, 1, 2)
+
+		sorted := slices.Clone(list)
+		slices.Sort(sorted)
+		assert.Equal(t, sorted[1], list[median], "%v", list)
+	}
+}
+
+func TestFloydRivestPivot_nearRank(t *testing.T) {
+	n := 100 * 1000
+	list := rand.Perm(n)
+	less := func(i, j int) bool { return list[i] < list[j] }
+	rng, _ := newRand()
+
+	for _, rank := range []int{0, n / 100, n / 2, n - 1} {
+		pivot := FloydRivestPivot{SampleSize: 1000}.Pivot(rng, less, 0, n-1, rank)
+
+		//With list a permutation the value is the rank, a 1000 element sample lands within a few percent
+		assert.InDelta(t, rank, list[pivot], float64(n)/20, "rank %v", rank)
+	}
+}
+
+func TestMedianOfMediansPivot_split(t *testing.T) {
+	rng, seed := newRand()
+
+	for _, n := range []int{1, 5, 6, 24, 25, 1000, 12345} {
+		for _, values := range []int{2, n} {
+			list := make([]int, n)
+			for i := range list {
+				list[i] = rng.IntN(values)
+			}
+			less := func(i, j int) bool { return list[i] < list[j] }
+
+			pivot := MedianOfMediansPivot{}.Pivot(rng, less, 0, n-1, 0)
+
+			below, above := 0, 0
+			for _, v := range list {
+				if v < list[pivot] {
+					below++
+				} else if v > list[pivot] {
+					above++
+				}
+			}
+			//At least 3/10 (less a group or two of slack) are not below and not above the pivot
+			assert.LessOrEqual(t, below, n*7/10+5, "n %v, values %v, seed %v", n, values, seed)
+			assert.LessOrEqual(t, above, n*7/10+5, "n %v, values %v, seed %v", n, values, seed)
+		}
+	}
+}
+
+// minimumPivot is the worst possible strategy, always the smallest element so every round removes a single element
+type minimumPivot struct {
+	calls *int
+}
+
+func (p minimumPivot) Pivot(rng *rand.Rand, less func(i, j int) bool, left, right, rank int) int {
+	*p.calls++
+	minimum := left
+	for i := left + 1; i <= right; i++ {
+		if less(i, minimum) {
+			minimum = i
+		}
+	}
+	return minimum
+}
+
+// secondSmallestPivot always picks the second smallest element, so a strict partition moves exactly one element left
+type secondSmallestPivot struct {
+	calls *int
+}
+
+func (p secondSmallestPivot) Pivot(rng *rand.Rand, less func(i, j int) bool, left, right, rank int) int {
+	*p.calls++
+	smallest, second := left, left+1
+	if less(second, smallest) {
+		smallest, second = second, smallest
+	}
+	for i := left + 2; i <= right; i++ {
+		if less(i, smallest) {
+			smallest, second = i, smallest
+		} else if less(i, second) {
+			second = i
+		}
+	}
+	return second
+}
+
+func TestSelectTopN_singlePassRounds(t *testing.T) {
+	list := rand.Perm(1000)
+	calls := 0
+	var stats Stats
+
+	_, err := SelectTopN(list, 1, Options{BlockSize: 16, Workers: 1, Pivot: secondSmallestPivot{&calls}, Stats: &stats})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, list[1])
+	//Each round's pivot has a smaller element, so no round needs a second pass to split off the band equal to it
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, calls, stats.Partitions)
+}
+
+func TestSelectTopN_introselectFallback(t *testing.T) {
+	n := 50 * 1000
+	list := rand.Perm(n)
+	calls := 0
+
+	_, err := SelectTopN(list, n-1, Options{BlockSize: 64, Workers: 1, Pivot: minimumPivot{&calls}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, n-1, list[n-1])
+	//Without the fallback every one of the n-1 rounds would use the strategy, with it the rounds stop using it once
+	//they have partitioned introselectWork times n elements
+	assert.LessOrEqual(t, calls, introselectWork+1)
+}
+
+func TestSelectTopN_introsortFallback(t *testing.T) {
+	n := 20 * 1000
+	list := rand.Perm(n)
+	calls := 0
+
+	_, err := SelectTopN(list, n-1, Options{BlockSize: 64, Workers: 1, Sorted: true, Pivot: minimumPivot{&calls}})
+
+	assert.NoError(t, err)
+	assert.True(t, slices.IsSorted(list), "list %v", list)
+	//The sort would otherwise make n quadratic rounds, it falls back after log2(n) unbalanced ones
+	assert.LessOrEqual(t, calls, introselectWork+1+bits.Len(uint(n))+1)
+}
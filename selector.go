@@ -0,0 +1,68 @@
+package topn
+
+import (
+	"cmp"
+	"context"
+	"math/rand/v2"
+)
+
+// Selector selects the top N of one slice after another, reusing the same scratch buffers, closures and random source
+// for each, so that once a selection over a slice at least as long has grown its buffers, selections with one worker
+// make no heap allocations at all unless the strategy is SampledMedianPivot or FloydRivestPivot (which sort a new
+// sample for each pivot)
+// With more workers each round of a partition still starts its goroutines, and a worker stealing part of another's
+// block allocates the count of the parts it is split into, so selections allocate in proportion to their rounds.
+// Without a Rand in its Options the source is reseeded at random for each selection, the seed recorded in Stats so
+// that the selection can be replayed as for SelectTopN.
+// A Selector must not be used by concurrent calls, and does not keep a reference to the slices it selects from.
+type Selector[T any] struct {
+	opts Options
+	p    *slicePartitioner[T]
+	// pcg the source of opts.Rand when the Options had none, reseeded for each selection
+	pcg *rand.PCG
+}
+
+// NewSelector a Selector of the elements as cmp.Less orders them, using opts for every selection
+// Invalid Options give the same errors as SelectTopN.
+func NewSelector[T cmp.Ordered](opts Options) (*Selector[T], error) {
+	return NewSelectorFunc(opts, cmp.Less[T])
+}
+
+// NewSelectorFunc is NewSelector with the elements ordered by less, which must be a strict weak ordering
+func NewSelectorFunc[T any](opts Options, less func(a, b T) bool) (*Selector[T], error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	var pcg *rand.PCG
+	if opts.Rand == nil {
+		pcg = rand.NewPCG(0, 0)
+		opts.Rand = rand.New(pcg)
+	}
+	opts.indices = new([]int)
+	return &Selector[T]{opts: opts, p: newSlicePartitioner(nil, opts, lessFor(opts.Order, less)), pcg: pcg}, nil
+}
+
+// SelectTopN is SelectTopN (or SelectTopNFunc) with the Options and ordering of s
+func (s *Selector[T]) SelectTopN(list []T, n int) (int, error) {
+	return s.SelectTopNContext(context.Background(), list, n)
+}
+
+// SelectTopNContext is SelectTopNContext (or SelectTopNFuncContext) with the Options and ordering of s
+func (s *Selector[T]) SelectTopNContext(ctx context.Context, list []T, n int) (int, error) {
+	if err := validateSelect(len(list), n, s.opts); err != nil {
+		return 0, err
+	}
+
+	if s.pcg != nil {
+		seed := rand.Uint64()
+		s.pcg.Seed(seed, 0)
+		if s.opts.Stats != nil {
+			s.opts.Stats.Seed = seed
+		}
+	}
+	s.p.list = list
+	defer func() { s.p.list = nil }()
+
+	return selectTop(ctx, s.p, len(list), n, s.opts)
+}
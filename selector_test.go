@@ -0,0 +1,133 @@
+package topn
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelector(t *testing.T) {
+	for _, sorted := range []bool{false, true} {
+		s, err := NewSelector[int](Options{BlockSize: 64, Workers: 4, Sorted: sorted})
+		assert.NoError(t, err)
+
+		for _, length := range []int{10 * 1000, 1, 500, 20 * 1000} {
+			list := generateList(length)
+			want := slices.Clone(list)
+			slices.Sort(want)
+			n := length / 3
+
+			k, err := s.SelectTopN(list, n)
+
+			assert.NoError(t, err)
+			assert.Equal(t, n, k)
+			top := slices.Clone(list[:n])
+			if !sorted {
+				slices.Sort(top)
+			}
+			assert.Equal(t, want[:n], top, "sorted %v length %v", sorted, length)
+			assert.Equal(t, want[n], list[n], "sorted %v length %v", sorted, length)
+		}
+	}
+}
+
+func TestSelectorFunc_descending(t *testing.T) {
+	s, err := NewSelectorFunc(Options{BlockSize: 1, Order: Descending, Sorted: true}, func(a, b string) bool { return a < b })
+	assert.NoError(t, err)
+
+	list := []string{"kiwi", "fig", "banana", "apple", "cherry", "pear", "plum"}
+	_, err = s.SelectTopN(list, 2)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"plum", "pear", "kiwi"}, list[:3])
+}
+
+func TestSelector_errors(t *testing.T) {
+	_, err := NewSelector[int](Options{BlockSize: -1})
+	assert.ErrorIs(t, err, ErrInvalidBlockSize)
+
+	s, err := NewSelector[int](Options{})
+	assert.NoError(t, err)
+	_, err = s.SelectTopN(nil, 0)
+	assert.ErrorIs(t, err, ErrEmptyInput)
+	_, err = s.SelectTopN([]int{3, 2, 1}, 3)
+	assert.ErrorIs(t, err, ErrRankOutOfRange)
+}
+
+func TestSelector_replaySeed(t *testing.T) {
+	var stats Stats
+	s, err := NewSelector[int](Options{BlockSize: 16, Workers: 1, Stats: &stats})
+	assert.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		original := generateList(5 * 1000)
+		list := slices.Clone(original)
+		_, err := s.SelectTopN(list, 1234)
+		assert.NoError(t, err)
+
+		//Each selection, not just the first, replays from the seed it recorded
+		replay := slices.Clone(original)
+		_, err = SelectTopN(replay, 1234, Options{BlockSize: 16, Workers: 1, Rand: newSeededRand(stats.Seed)})
+		assert.NoError(t, err)
+		assert.Equal(t, list, replay, "selection %v seed %v", i, stats.Seed)
+	}
+}
+
+func TestSelector_allocations(t *testing.T) {
+	pivots := map[string]PivotStrategy{
+		"random": RandomPivot{}, "median-of-three": MedianOfThreePivot{}, "ninther": NintherPivot{}, "median-of-medians": MedianOfMediansPivot{},
+	}
+
+	for name, pivot := range pivots {
+		for _, scheme := range []PartitionScheme{BlockNeutralisation, StridedBlocks} {
+			for _, sorted := range []bool{false, true} {
+				s, err := NewSelector[int](Options{BlockSize: 64, Workers: 1, Sorted: sorted, Scheme: scheme, Pivot: pivot})
+				assert.NoError(t, err)
+				original := generateList(100 * 1000)
+				list := make([]int, len(original))
+				//Grow the buffers
+				copy(list, original)
+				_, err = s.SelectTopN(list, 5000)
+				assert.NoError(t, err)
+
+				allocs := testing.AllocsPerRun(10, func() {
+					copy(list, original)
+					if _, err := s.SelectTopN(list, 5000); err != nil {
+						t.Fatal(err)
+					}
+				})
+
+				assert.Zero(t, allocs, fmt.Sprint(name, " scheme ", scheme, " sorted ", sorted))
+			}
+		}
+	}
+}
+
+func TestSelector_allocationsWorkers(t *testing.T) {
+	for _, workers := range []int{2, 4, 8} {
+		stats := &Stats{}
+		s, err := NewSelector[int](Options{BlockSize: 64, Workers: workers, Stats: stats})
+		assert.NoError(t, err)
+		original := generateList(100 * 1000)
+		list := make([]int, len(original))
+		copy(list, original)
+		_, err = s.SelectTopN(list, 5000)
+		assert.NoError(t, err)
+		*stats = Stats{}
+
+		//AllocsPerRun makes one more call than it averages over
+		runs := 10
+		allocs := testing.AllocsPerRun(runs, func() {
+			copy(list, original)
+			if _, err := s.SelectTopN(list, 5000); err != nil {
+				t.Fatal(err)
+			}
+		})
+
+		//The goroutines of each round, along with any steals, but nothing in proportion to the length of the list
+		rounds := float64(stats.Rounds) / float64(runs+1)
+		assert.LessOrEqual(t, allocs, 4*float64(workers)*rounds, "workers %v rounds %v", workers, rounds)
+	}
+}
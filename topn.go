@@ -0,0 +1,513 @@
+// Package topn selects the top N elements of a slice in place, partitioning around each pivot with blocks of the slice
+// neutralised against each other on parallel workers.
+package topn
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+)
+
+// DefaultBlockSize the block size used when Options.BlockSize is not set
+const DefaultBlockSize = 1024
+
+var (
+	// ErrEmptyInput the list (or range of it) to select from or partition has no elements
+	ErrEmptyInput = errors.New("topn: empty input")
+	// ErrRankOutOfRange the requested rank does not index an element of the list
+	ErrRankOutOfRange = errors.New("topn: rank out of range")
+	// ErrInvalidRange the lo and hi indices given to a partition are not a range of the list
+	ErrInvalidRange = errors.New("topn: invalid range")
+	// ErrInvalidBlockSize Options.BlockSize is negative
+	ErrInvalidBlockSize = errors.New("topn: invalid block size")
+	// ErrInvalidOrder Options.Order is neither Ascending nor Descending
+	ErrInvalidOrder = errors.New("topn: invalid order")
+	// ErrInvalidQuantile a requested quantile is not in [0, 1]
+	ErrInvalidQuantile = errors.New("topn: invalid quantile")
+	// ErrInvalidScheme Options.Scheme is neither BlockNeutralisation nor StridedBlocks
+	ErrInvalidScheme = errors.New("topn: invalid partition scheme")
+)
+
+// Order the direction elements are selected in
+type Order int
+
+const (
+	// Ascending select the smallest elements first
+	Ascending Order = iota
+	// Descending select the largest elements first, the exact reverse of Ascending (so NaNs come last)
+	Descending
+)
+
+// PartitionScheme the algorithm each parallel partition runs
+type PartitionScheme int
+
+const (
+	// BlockNeutralisation workers claim blocks from both ends of the range and neutralise them against each other, the
+	// default
+	BlockNeutralisation PartitionScheme = iota
+	// StridedBlocks the range is dealt out round-robin in blocks to the workers, which each partition their own strided
+	// sub list before the misplaced region between the sub lists' splits is partitioned again
+	StridedBlocks
+)
+
+// Options configure a selection or partition, the zero value uses the defaults
+type Options struct {
+	// BlockSize the number of elements in each block a worker claims, 0 uses DefaultBlockSize and negative sizes are
+	// rejected with ErrInvalidBlockSize
+	BlockSize int
+	// Workers the number of goroutines neutralising blocks, <= 0 uses GOMAXPROCS
+	Workers int
+	// Order whether the smallest (Ascending, the default) or largest (Descending) elements are selected, for a
+	// partition Descending puts the elements greater than the pivot first
+	Order Order
+	// Sorted whether a selection also sorts the selected elements into Order, ignored by partitions
+	Sorted bool
+	// Scheme the algorithm partitioning slices, ignored by selections over an Interface or chunks
+	Scheme PartitionScheme
+	// Pivot chooses the pivot of each selection round, nil uses RandomPivot
+	Pivot PivotStrategy
+	// Rand the source of all randomness in a selection, so with a single worker a selection given a Rand seeded the
+	// same way (e.g. rand.New(rand.NewPCG(seed, 0))) over the same input replays exactly, with more workers the order
+	// blocks are claimed in also varies between runs
+	// nil seeds a new source for each call, rand.New(rand.NewPCG(seed, 0)) with the seed recorded in Stats, a Rand must
+	// not be shared by concurrent calls
+	Rand *rand.Rand
+	// Stats (unless nil) has the work of every partition a call makes added to it, a Stats must not be shared by
+	// concurrent calls
+	Stats *Stats
+
+	// swap is called (unless nil) with the indices of every pair of elements a selection swaps, set by SelectTopNSwap
+	swap func(i, j int)
+	// indices (unless nil) the scratch MedianOfMediansPivot reuses, set by a Selector
+	indices *[]int
+}
+
+// Stats counts the rounds the parallel partitions of a selection or partition needed, for instrumenting them
+// Every round after the first of a partition repartitions the middle of the range the round before left misplaced
+// (its unneutralised blocks, or the region between the strided sub lists' splits).
+type Stats struct {
+	// Partitions the number of parallel partitions run, two for each selection round in which no element is less than
+	// the pivot
+	Partitions int
+	// Rounds the total rounds of all the partitions, at least one each
+	Rounds int
+	// MaxRounds the most rounds any one partition needed
+	MaxRounds int
+	// Seed the seed of the source the last call without a Rand drew from, passing rand.New(rand.NewPCG(Seed, 0)) as
+	// the Rand of the same call replays it
+	Seed uint64
+}
+
+// record adds a partition that needed rounds rounds to s, unless s is nil
+func (s *Stats) record(rounds int) {
+	if s == nil {
+		return
+	}
+	s.Partitions++
+	s.Rounds += rounds
+	s.MaxRounds = max(s.MaxRounds, rounds)
+}
+
+func (o Options) validate() error {
+	if o.BlockSize < 0 {
+		return fmt.Errorf("%w: %v", ErrInvalidBlockSize, o.BlockSize)
+	}
+	if o.Order != Ascending && o.Order != Descending {
+		return fmt.Errorf("%w: %v", ErrInvalidOrder, o.Order)
+	}
+	if o.Scheme != BlockNeutralisation && o.Scheme != StridedBlocks {
+		return fmt.Errorf("%w: %v", ErrInvalidScheme, o.Scheme)
+	}
+
+	return nil
+}
+
+func (o Options) blockSize() int {
+	if o.BlockSize == 0 {
+		return DefaultBlockSize
+	}
+
+	return o.BlockSize
+}
+
+// rand the source of a call, o.Rand unless it is nil, otherwise a new one seeded at random and the seed recorded in
+// o.Stats
+func (o Options) rand() *rand.Rand {
+	if o.Rand == nil {
+		seed := rand.Uint64()
+		if o.Stats != nil {
+			o.Stats.Seed = seed
+		}
+		return rand.New(rand.NewPCG(seed, 0))
+	}
+
+	return o.Rand
+}
+
+func (o Options) pivot() PivotStrategy {
+	if o.Pivot == nil {
+		return RandomPivot{}
+	}
+	if _, ok := o.Pivot.(MedianOfMediansPivot); ok {
+		return o.medianOfMedians()
+	}
+
+	return o.Pivot
+}
+
+// medianOfMedians the MedianOfMediansPivot selections fall back to, reusing o.indices
+func (o Options) medianOfMedians() PivotStrategy {
+	return MedianOfMediansPivot{o.indices}
+}
+
+// lessFor the ordering elements are selected in given their natural ordering less, the reverse of it for Descending
+func lessFor[T any](o Order, less func(a, b T) bool) func(a, b T) bool {
+	if o == Descending {
+		return func(a, b T) bool { return less(b, a) }
+	}
+
+	return less
+}
+
+// orderedLess the ordering elements are selected in by cmp.Less, for Descending the arguments are swapped rather than
+// the values negated (which overflows for the minimum integer)
+func orderedLess[T cmp.Ordered](o Order) func(a, b T) bool {
+	return lessFor(o, cmp.Less[T])
+}
+
+// validateSelect check a selection of rank n from a list of length elements can be made
+func validateSelect(length int, n int, opts Options) error {
+	if length == 0 {
+		return ErrEmptyInput
+	}
+	if n < 0 || n >= length {
+		return fmt.Errorf("%w: %v is not in [0, %v)", ErrRankOutOfRange, n, length)
+	}
+
+	return opts.validate()
+}
+
+// validateRanks check every one of ranks can be selected from a list of length elements
+func validateRanks(length int, ranks []int, opts Options) error {
+	if length == 0 {
+		return ErrEmptyInput
+	}
+	for _, rank := range ranks {
+		if rank < 0 || rank >= length {
+			return fmt.Errorf("%w: %v is not in [0, %v)", ErrRankOutOfRange, rank, length)
+		}
+	}
+
+	return opts.validate()
+}
+
+// validatePartition check list[lo:hi+1] of a list of length elements can be partitioned
+func validatePartition(length int, lo, hi int, opts Options) error {
+	if length == 0 {
+		return ErrEmptyInput
+	}
+	if lo < 0 || hi >= length || lo > hi {
+		return fmt.Errorf("%w: [%v, %v] is not a range of [0, %v)", ErrInvalidRange, lo, hi, length)
+	}
+
+	return opts.validate()
+}
+
+// SelectTopN reorders list so that list[:n] holds its n smallest (or with Descending, largest) elements, in no
+// particular order unless Sorted is set, and list[n] the next one, returning n
+// Elements are ordered as cmp.Less orders them, so NaNs are the smallest floats.
+// An empty list gives ErrEmptyInput and an n outside [0, len(list)) gives ErrRankOutOfRange, in both cases (and for
+// invalid Options) the list is left untouched.
+func SelectTopN[T cmp.Ordered](list []T, n int, opts Options) (int, error) {
+	return SelectTopNContext(context.Background(), list, n, opts)
+}
+
+// SelectTopNContext is SelectTopN abandoned once ctx is done
+// ctx is checked between selection rounds and between the blocks each worker claims, when it is done ctx.Err() is
+// returned and list is left a permutation of its original elements (but in no useful order).
+func SelectTopNContext[T cmp.Ordered](ctx context.Context, list []T, n int, opts Options) (int, error) {
+	if err := validateSelect(len(list), n, opts); err != nil {
+		return 0, err
+	}
+
+	return selectTopN(ctx, list, n, opts, orderedLess[T](opts.Order))
+}
+
+// SelectTopNFunc is SelectTopN with the elements ordered by less, which must be a strict weak ordering
+func SelectTopNFunc[T any](list []T, n int, opts Options, less func(a, b T) bool) (int, error) {
+	return SelectTopNFuncContext(context.Background(), list, n, opts, less)
+}
+
+// SelectTopNFuncContext is SelectTopNFunc abandoned once ctx is done, as for SelectTopNContext
+func SelectTopNFuncContext[T any](ctx context.Context, list []T, n int, opts Options, less func(a, b T) bool) (int, error) {
+	if err := validateSelect(len(list), n, opts); err != nil {
+		return 0, err
+	}
+
+	return selectTopN(ctx, list, n, opts, lessFor(opts.Order, less))
+}
+
+// SelectTopNSwap is SelectTopN over struct-of-arrays data, keys are reordered as SelectTopN reorders list and every swap
+// of two keys is mirrored by a call to swap with their indices, so any number of companion columns can follow them
+// swap is called from several workers at once, but never with the same index on two of them, so swapping the elements
+// of slices needs no locking.
+func SelectTopNSwap[T cmp.Ordered](keys []T, n int, opts Options, swap func(i, j int)) (int, error) {
+	if err := validateSelect(len(keys), n, opts); err != nil {
+		return 0, err
+	}
+
+	opts.swap = swap
+	return selectTopN(context.Background(), keys, n, opts, orderedLess[T](opts.Order))
+}
+
+// SelectTopNSwapFunc is SelectTopNSwap with the keys ordered by less, which must be a strict weak ordering
+func SelectTopNSwapFunc[T any](keys []T, n int, opts Options, less func(a, b T) bool, swap func(i, j int)) (int, error) {
+	if err := validateSelect(len(keys), n, opts); err != nil {
+		return 0, err
+	}
+
+	opts.swap = swap
+	return selectTopN(context.Background(), keys, n, opts, lessFor(opts.Order, less))
+}
+
+// selectTopN selects the top n of the validated list, then sorts them if asked to
+func selectTopN[T any](ctx context.Context, list []T, n int, opts Options, less func(a, b T) bool) (int, error) {
+	return selectTop(ctx, newSlicePartitioner(list, opts, less), len(list), n, opts)
+}
+
+// selectTop selects the top n of the validated list of length elements that p partitions, then sorts them if asked to
+func selectTop(ctx context.Context, p partitioner, length int, n int, opts Options) (int, error) {
+	//Share one source between the selection and the sort, either way the whole call replays from it
+	opts.Rand = opts.rand()
+	k, err := selectTopRange(ctx, p, 0, length-1, n, opts)
+	if err != nil {
+		return 0, err
+	}
+	if opts.Sorted {
+		if err := sortRange(ctx, p, 0, k-1, opts); err != nil {
+			return 0, err
+		}
+	}
+
+	return k, nil
+}
+
+// ArgSelectTopN is SelectTopN without reordering list, returning the indices of its n smallest (or with Descending,
+// largest) elements instead, in no particular order unless Sorted is set
+// The selection partitions a permutation of the indices of list, comparing the elements they index.
+// Errors are as for SelectTopN.
+func ArgSelectTopN[T cmp.Ordered](list []T, n int, opts Options) ([]int, error) {
+	if err := validateSelect(len(list), n, opts); err != nil {
+		return nil, err
+	}
+
+	return argSelectTopN(list, n, opts, orderedLess[T](opts.Order))
+}
+
+// ArgSelectTopNFunc is ArgSelectTopN with the elements ordered by less, which must be a strict weak ordering
+func ArgSelectTopNFunc[T any](list []T, n int, opts Options, less func(a, b T) bool) ([]int, error) {
+	if err := validateSelect(len(list), n, opts); err != nil {
+		return nil, err
+	}
+
+	return argSelectTopN(list, n, opts, lessFor(opts.Order, less))
+}
+
+// argSelectTopN selects the top n of the indices of the validated list, ordered by the elements they index
+func argSelectTopN[T any](list []T, n int, opts Options, less func(a, b T) bool) ([]int, error) {
+	indices := make([]int, len(list))
+	for i := range indices {
+		indices[i] = i
+	}
+
+	k, err := selectTopN(context.Background(), indices, n, opts, func(i, j int) bool {
+		return less(list[i], list[j])
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return indices[:k], nil
+}
+
+// SelectRange reorders list so that list[a:b+1] holds the elements ranked a through b (inclusive), the ones that would be
+// there were list sorted (into Order), in no particular order unless Sorted is set, returning list[a:b+1]
+// Every element before a is not greater than them and every element after b is not less.
+// An empty list gives ErrEmptyInput and a, b not forming a range of the list gives ErrInvalidRange, in both cases (and
+// for invalid Options) the list is left untouched.
+func SelectRange[T cmp.Ordered](list []T, a, b int, opts Options) ([]T, error) {
+	if err := validatePartition(len(list), a, b, opts); err != nil {
+		return nil, err
+	}
+
+	return selectRange(list, a, b, opts, orderedLess[T](opts.Order))
+}
+
+// SelectRangeFunc is SelectRange with the elements ordered by less, which must be a strict weak ordering
+func SelectRangeFunc[T any](list []T, a, b int, opts Options, less func(a, b T) bool) ([]T, error) {
+	if err := validatePartition(len(list), a, b, opts); err != nil {
+		return nil, err
+	}
+
+	return selectRange(list, a, b, opts, lessFor(opts.Order, less))
+}
+
+// selectRange selects rank a of the validated list, then rank b of what is left above it, then sorts between them if
+// asked to
+func selectRange[T any](list []T, a, b int, opts Options, less func(a, b T) bool) ([]T, error) {
+	ctx := context.Background()
+	opts.Rand = opts.rand()
+	p := newSlicePartitioner(list, opts, less)
+	if _, err := selectTopRange(ctx, p, 0, len(list)-1, a, opts); err != nil {
+		return nil, err
+	}
+	//The second pass is bounded to the elements not less than rank a
+	if b > a {
+		if _, err := selectTopRange(ctx, p, a, len(list)-1, b, opts); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Sorted {
+		if err := sortRange(ctx, p, a, b, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	return list[a : b+1], nil
+}
+
+// SelectRanks reorders list so that for each of ranks list[rank] holds the element that would be there were list sorted
+// (into Order), with every element before it not greater and every element after it not less, in a single pass
+// partitioning each range only as far as the requested ranks need
+// ranks may be in any order and repeat, it is not modified. Sorted is ignored.
+// An empty list gives ErrEmptyInput and any rank outside [0, len(list)) gives ErrRankOutOfRange, in both cases (and for
+// invalid Options) the list is left untouched.
+func SelectRanks[T cmp.Ordered](list []T, ranks []int, opts Options) error {
+	if err := validateRanks(len(list), ranks, opts); err != nil {
+		return err
+	}
+
+	return selectRanks(list, ranks, opts, orderedLess[T](opts.Order))
+}
+
+// SelectRanksFunc is SelectRanks with the elements ordered by less, which must be a strict weak ordering
+func SelectRanksFunc[T any](list []T, ranks []int, opts Options, less func(a, b T) bool) error {
+	if err := validateRanks(len(list), ranks, opts); err != nil {
+		return err
+	}
+
+	return selectRanks(list, ranks, opts, lessFor(opts.Order, less))
+}
+
+// selectRanks selects the validated ranks of list, sorted and deduplicated
+func selectRanks[T any](list []T, ranks []int, opts Options, less func(a, b T) bool) error {
+	ranks = slices.Clone(ranks)
+	slices.Sort(ranks)
+	ranks = slices.Compact(ranks)
+
+	return selectRanksFunc(context.Background(), list, 0, len(list)-1, ranks, opts, less)
+}
+
+// Quantiles reorders list as SelectRanks does to find each of qs, returning the q-quantile of list for each q in qs
+// The q-quantile is the nearest rank, the element at rank ceil(q*len(list))-1 (0 for q = 0), so with Descending it is
+// the q-quantile from the top.
+// Errors are as for SelectRanks, with any q that is not in [0, 1] giving ErrInvalidQuantile.
+func Quantiles[T cmp.Ordered](list []T, qs []float64, opts Options) ([]T, error) {
+	return quantiles(list, qs, opts, orderedLess[T](opts.Order))
+}
+
+// QuantilesFunc is Quantiles with the elements ordered by less, which must be a strict weak ordering
+func QuantilesFunc[T any](list []T, qs []float64, opts Options, less func(a, b T) bool) ([]T, error) {
+	return quantiles(list, qs, opts, lessFor(opts.Order, less))
+}
+
+// quantiles validates qs and the list, then selects the quantiles of list
+func quantiles[T any](list []T, qs []float64, opts Options, less func(a, b T) bool) ([]T, error) {
+	ranks := make([]int, len(qs))
+	for i, q := range qs {
+		if !(q >= 0 && q <= 1) {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidQuantile, q)
+		}
+		ranks[i] = max(int(math.Ceil(q*float64(len(list))))-1, 0)
+	}
+	if err := validateRanks(len(list), ranks, opts); err != nil {
+		return nil, err
+	}
+
+	if err := selectRanks(list, ranks, opts, less); err != nil {
+		return nil, err
+	}
+	values := make([]T, len(ranks))
+	for i, rank := range ranks {
+		values[i] = list[rank]
+	}
+
+	return values, nil
+}
+
+// PartitionParallel partitions list[lo:hi+1] so the elements less than pivot (or with Descending, greater than it) come
+// first, returning the index of the first element that is not (hi+1 when every element is)
+// An empty list gives ErrEmptyInput and lo, hi not forming a range of the list gives ErrInvalidRange, in both cases
+// (and for invalid Options) the list is left untouched.
+func PartitionParallel[T cmp.Ordered](list []T, lo, hi int, pivot T, opts Options) (int, error) {
+	return PartitionParallelContext(context.Background(), list, lo, hi, pivot, opts)
+}
+
+// PartitionParallelContext is PartitionParallel abandoned once ctx is done
+// ctx is checked between the blocks each worker claims, when it is done ctx.Err() is returned and list is left a
+// permutation of its original elements (but not partitioned).
+func PartitionParallelContext[T cmp.Ordered](ctx context.Context, list []T, lo, hi int, pivot T, opts Options) (int, error) {
+	if err := validatePartition(len(list), lo, hi, opts); err != nil {
+		return 0, err
+	}
+
+	return partitionerAround(list, pivot, opts, orderedLess[T](opts.Order)).partition(ctx, lo, hi, false)
+}
+
+// PartitionParallelFunc is PartitionParallel with the elements ordered by less, which must be a strict weak ordering
+func PartitionParallelFunc[T any](list []T, lo, hi int, pivot T, opts Options, less func(a, b T) bool) (int, error) {
+	return PartitionParallelFuncContext(context.Background(), list, lo, hi, pivot, opts, less)
+}
+
+// PartitionParallelFuncContext is PartitionParallelFunc abandoned once ctx is done, as for PartitionParallelContext
+func PartitionParallelFuncContext[T any](ctx context.Context, list []T, lo, hi int, pivot T, opts Options, less func(a, b T) bool) (int, error) {
+	if err := validatePartition(len(list), lo, hi, opts); err != nil {
+		return 0, err
+	}
+
+	return partitionerAround(list, pivot, opts, lessFor(opts.Order, less)).partition(ctx, lo, hi, false)
+}
+
+// PartitionParallelThreeWay partitions list[lo:hi+1] into the elements less than pivot, those equal to it and those
+// greater than it (or with Descending, greater, equal then less), returning lt the index of the first element equal to
+// pivot and gt the index of the first element after them, so list[lt:gt] holds every element equal to pivot
+// Errors are as for PartitionParallel.
+func PartitionParallelThreeWay[T cmp.Ordered](list []T, lo, hi int, pivot T, opts Options) (lt int, gt int, err error) {
+	if err := validatePartition(len(list), lo, hi, opts); err != nil {
+		return 0, 0, err
+	}
+
+	return partitionThreeWay(context.Background(), partitionerAround(list, pivot, opts, orderedLess[T](opts.Order)), lo, hi)
+}
+
+// PartitionParallelThreeWayFunc is PartitionParallelThreeWay with the elements ordered by less, which must be a strict
+// weak ordering, elements are equal to pivot when neither is less than the other
+func PartitionParallelThreeWayFunc[T any](list []T, lo, hi int, pivot T, opts Options, less func(a, b T) bool) (lt int, gt int, err error) {
+	if err := validatePartition(len(list), lo, hi, opts); err != nil {
+		return 0, 0, err
+	}
+
+	return partitionThreeWay(context.Background(), partitionerAround(list, pivot, opts, lessFor(opts.Order, less)), lo, hi)
+}
+
+// partitionerAround the partitioner of list with pivot as its pivot
+func partitionerAround[T any](list []T, pivot T, opts Options, less func(a, b T) bool) *slicePartitioner[T] {
+	p := newSlicePartitioner(list, opts, less)
+	p.pivotValue = pivot
+
+	return p
+}
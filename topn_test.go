@@ -0,0 +1,712 @@
+package topn
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectTopN(t *testing.T) {
+	list := generateList(10 * 1000)
+	sorted := slices.Clone(list)
+	slices.Sort(sorted)
+
+	k, err := SelectTopN(list, 100, Options{BlockSize: 64, Workers: 4})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 100, k)
+	prefix := slices.Clone(list[:100])
+	slices.Sort(prefix)
+	assert.Equal(t, sorted[:100], prefix)
+	assert.Equal(t, sorted[100], list[100])
+}
+
+func TestSelectTopN_edges(t *testing.T) {
+	for _, n := range []int{0, 1, 9} {
+		list := []int{5, 3, 8, 1, 9, 2, 7, 4, 6, 0}
+
+		k, err := SelectTopN(list, n, Options{BlockSize: 1})
+
+		assert.NoError(t, err)
+		assert.Equal(t, n, k)
+		assert.Equal(t, n, list[n])
+	}
+
+	list := []int{42}
+	k, err := SelectTopN(list, 0, Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, k)
+}
+
+func TestSelectTopN_descending(t *testing.T) {
+	list := []int{math.MinInt, 5, math.MaxInt, -3, 0, math.MinInt, 12, 7, math.MaxInt, 1}
+
+	k, err := SelectTopN(list, 3, Options{BlockSize: 2, Workers: 2, Order: Descending})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, k)
+	assert.ElementsMatch(t, []int{math.MaxInt, math.MaxInt, 12}, list[:3])
+	assert.Equal(t, 7, list[3])
+
+	for _, workers := range []int{1, 4} {
+		list := generateList(10 * 1000)
+		sorted := slices.Clone(list)
+		slices.Sort(sorted)
+		slices.Reverse(sorted)
+
+		_, err := SelectTopN(list, 500, Options{BlockSize: 16, Workers: workers, Order: Descending})
+
+		assert.NoError(t, err)
+		prefix := slices.Clone(list[:500])
+		slices.Sort(prefix)
+		slices.Reverse(prefix)
+		assert.Equal(t, sorted[:500], prefix)
+		assert.Equal(t, sorted[500], list[500])
+	}
+}
+
+func TestSelectTopNFunc_descending(t *testing.T) {
+	list := []string{"pear", "fig", "cherries", "apple", "banana"}
+
+	k, err := SelectTopNFunc(list, 2, Options{Order: Descending}, func(a, b string) bool { return len(a) < len(b) })
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, k)
+	assert.ElementsMatch(t, []string{"cherries", "banana"}, list[:2])
+	assert.Equal(t, "apple", list[2])
+}
+
+func TestSelectTopN_sorted(t *testing.T) {
+	for _, order := range []Order{Ascending, Descending} {
+		for _, n := range []int{0, 1, 13, 999, 9999} {
+			list := generateList(10 * 1000)
+			for i := 0; i < len(list); i += 3 {
+				list[i] = list[i/2] //Plenty of duplicates
+			}
+			sorted := slices.Clone(list)
+			slices.Sort(sorted)
+			if order == Descending {
+				slices.Reverse(sorted)
+			}
+
+			_, err := SelectTopN(list, n, Options{BlockSize: 32, Workers: 4, Order: order, Sorted: true})
+
+			assert.NoError(t, err)
+			assert.Equal(t, sorted[:n+1], list[:n+1], "order %v, n %v", order, n)
+		}
+	}
+}
+
+func TestSelectTopN_seeded(t *testing.T) {
+	seed := rand.Uint64()
+	original := generateList(10 * 1000)
+
+	first := slices.Clone(original)
+	_, err := SelectTopN(first, 500, Options{BlockSize: 8, Workers: 1, Rand: rand.New(rand.NewPCG(seed, 0))})
+	assert.NoError(t, err)
+	second := slices.Clone(original)
+	_, err = SelectTopN(second, 500, Options{BlockSize: 8, Workers: 1, Rand: rand.New(rand.NewPCG(seed, 0))})
+	assert.NoError(t, err)
+
+	assert.Equal(t, first, second, "seed %v", seed)
+}
+
+func TestSelectTopN_replaySeed(t *testing.T) {
+	original := generateList(10 * 1000)
+
+	first := slices.Clone(original)
+	stats := &Stats{}
+	_, err := SelectTopN(first, 500, Options{BlockSize: 8, Workers: 1, Sorted: true, Stats: stats})
+	assert.NoError(t, err)
+	second := slices.Clone(original)
+	replayed := &Stats{}
+	_, err = SelectTopN(second, 500, Options{BlockSize: 8, Workers: 1, Sorted: true, Stats: replayed, Rand: rand.New(rand.NewPCG(stats.Seed, 0))})
+	assert.NoError(t, err)
+
+	assert.Equal(t, first, second, "seed %v", stats.Seed)
+	assert.Equal(t, stats.Rounds, replayed.Rounds)
+	assert.Zero(t, replayed.Seed, "a call given a Rand draws no seed")
+}
+
+func TestSelectTopNFunc_defaults(t *testing.T) {
+	list := []string{"pear", "fig", "cherries", "apple", "banana"}
+
+	k, err := SelectTopNFunc(list, 2, Options{}, func(a, b string) bool { return len(a) < len(b) })
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, k)
+	assert.ElementsMatch(t, []string{"fig", "pear"}, list[:2])
+	assert.Equal(t, "apple", list[2])
+}
+
+func TestSelectTopN_errors(t *testing.T) {
+	cases := []struct {
+		list []int
+		n    int
+		opts Options
+		err  error
+	}{
+		{nil, 0, Options{}, ErrEmptyInput},
+		{[]int{}, 0, Options{}, ErrEmptyInput},
+		{[]int{3, 2, 1}, -1, Options{}, ErrRankOutOfRange},
+		{[]int{3, 2, 1}, 3, Options{}, ErrRankOutOfRange},
+		{[]int{3, 2, 1}, 10, Options{}, ErrRankOutOfRange},
+		{[]int{3, 2, 1}, 1, Options{BlockSize: -1}, ErrInvalidBlockSize},
+		{[]int{3, 2, 1}, 1, Options{Order: Order(2)}, ErrInvalidOrder},
+		{[]int{3, 2, 1}, 1, Options{Scheme: PartitionScheme(2)}, ErrInvalidScheme},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("%v rank %v with %+v", c.list, c.n, c.opts), func(t *testing.T) {
+			original := slices.Clone(c.list)
+
+			_, err := SelectTopN(c.list, c.n, c.opts)
+			assert.ErrorIs(t, err, c.err)
+			_, err = SelectTopNFunc(c.list, c.n, c.opts, func(a, b int) bool { return a < b })
+			assert.ErrorIs(t, err, c.err)
+
+			assert.Equal(t, original, c.list)
+		})
+	}
+}
+
+func TestSelectTopNSwap(t *testing.T) {
+	for _, sorted := range []bool{false, true} {
+		for _, workers := range []int{1, 4} {
+			keys := make([]int64, 10*1000)
+			rowIDs := make([]uint32, len(keys))
+			scores := make([]float32, len(keys))
+			for i := range keys {
+				keys[i] = rand.Int64N(1000)
+				rowIDs[i] = uint32(i)
+				scores[i] = float32(keys[i]) / 2
+			}
+			original := slices.Clone(keys)
+			want := slices.Clone(keys)
+			slices.Sort(want)
+
+			k, err := SelectTopNSwap(keys, 100, Options{BlockSize: 64, Workers: workers, Sorted: sorted}, func(i, j int) {
+				rowIDs[i], rowIDs[j] = rowIDs[j], rowIDs[i]
+				scores[i], scores[j] = scores[j], scores[i]
+			})
+
+			assert.NoError(t, err)
+			assert.Equal(t, 100, k)
+			if sorted {
+				assert.Equal(t, want[:100], keys[:100])
+			}
+			assert.Equal(t, want[100], keys[100])
+			//The companion columns still line up with their keys
+			for i, key := range keys {
+				assert.Equal(t, original[rowIDs[i]], key)
+				assert.Equal(t, float32(key)/2, scores[i])
+			}
+		}
+	}
+}
+
+func TestSelectTopNSwapFunc_descending(t *testing.T) {
+	keys := []string{"kiwi", "fig", "banana", "apple", "cherry", "pear", "plum"}
+	rowIDs := []int{0, 1, 2, 3, 4, 5, 6}
+
+	_, err := SelectTopNSwapFunc(keys, 2, Options{BlockSize: 1, Order: Descending, Sorted: true}, func(a, b string) bool { return a < b }, func(i, j int) {
+		rowIDs[i], rowIDs[j] = rowIDs[j], rowIDs[i]
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"plum", "pear", "kiwi"}, keys[:3])
+	assert.Equal(t, []int{6, 5, 0}, rowIDs[:3])
+}
+
+func TestArgSelectTopN(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		list := generateList(10 * 1000)
+		original := slices.Clone(list)
+		sorted := slices.Clone(list)
+		slices.Sort(sorted)
+
+		indices, err := ArgSelectTopN(list, 100, Options{BlockSize: 64, Workers: workers})
+
+		assert.NoError(t, err)
+		assert.Equal(t, original, list)
+		assert.Len(t, indices, 100)
+		top := make([]int, len(indices))
+		for i, index := range indices {
+			top[i] = list[index]
+		}
+		slices.Sort(top)
+		assert.Equal(t, sorted[:100], top, "workers %v", workers)
+		//Every index is picked once
+		slices.Sort(indices)
+		assert.Len(t, slices.Compact(indices), 100)
+	}
+}
+
+func TestArgSelectTopNFunc_sorted(t *testing.T) {
+	list := []string{"kiwi", "fig", "banana", "apple", "cherry", "pear", "plum"}
+
+	indices, err := ArgSelectTopNFunc(list, 3, Options{BlockSize: 1, Order: Descending, Sorted: true}, func(a, b string) bool { return a < b })
+
+	assert.NoError(t, err)
+	assert.Equal(t, []int{6, 5, 0}, indices)
+	assert.Equal(t, []string{"kiwi", "fig", "banana", "apple", "cherry", "pear", "plum"}, list)
+
+	_, err = ArgSelectTopN([]int{3, 2, 1}, 3, Options{})
+	assert.ErrorIs(t, err, ErrRankOutOfRange)
+}
+
+func TestSelectRange(t *testing.T) {
+	for _, sorted := range []bool{false, true} {
+		for _, workers := range []int{1, 4} {
+			list := generateList(10 * 1000)
+			want := slices.Clone(list)
+			slices.Sort(want)
+
+			page, err := SelectRange(list, 1000, 1050, Options{BlockSize: 64, Workers: workers, Sorted: sorted})
+
+			assert.NoError(t, err)
+			assert.Len(t, page, 51)
+			if !sorted {
+				page = slices.Clone(page)
+				slices.Sort(page)
+			}
+			assert.Equal(t, want[1000:1051], page, "sorted %v workers %v", sorted, workers)
+			assert.LessOrEqual(t, slices.Max(list[:1000]), slices.Min(list[1000:1051]))
+			assert.GreaterOrEqual(t, slices.Min(list[1051:]), slices.Max(list[1000:1051]))
+		}
+	}
+}
+
+func TestSelectRange_edges(t *testing.T) {
+	for _, r := range [][2]int{{0, 0}, {0, 9}, {9, 9}, {3, 4}} {
+		list := []int{5, 3, 8, 1, 9, 2, 7, 4, 6, 0}
+
+		page, err := SelectRangeFunc(list, r[0], r[1], Options{BlockSize: 1, Sorted: true}, cmp.Less[int])
+
+		assert.NoError(t, err)
+		want := []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+		assert.Equal(t, want[r[0]:r[1]+1], page)
+	}
+
+	list := []int{5, 3, 8, 1, 9}
+	page, err := SelectRange(list, 1, 2, Options{Order: Descending, Sorted: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{8, 5}, page)
+}
+
+func TestSelectRange_errors(t *testing.T) {
+	for _, r := range [][2]int{{-1, 2}, {2, 1}, {0, 3}} {
+		list := []int{3, 2, 1}
+
+		_, err := SelectRange(list, r[0], r[1], Options{})
+
+		assert.ErrorIs(t, err, ErrInvalidRange)
+		assert.Equal(t, []int{3, 2, 1}, list)
+	}
+
+	_, err := SelectRange([]int{}, 0, 0, Options{})
+	assert.ErrorIs(t, err, ErrEmptyInput)
+	_, err = SelectRangeFunc([]int{3, 2, 1}, 0, 1, Options{BlockSize: -1}, cmp.Less[int])
+	assert.ErrorIs(t, err, ErrInvalidBlockSize)
+}
+
+func TestSelectRanks(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		list := generateList(100 * 1000)
+		sorted := slices.Clone(list)
+		slices.Sort(sorted)
+		ranks := []int{99999, 50000, 0, 90000, 99000, 50000, 99900}
+
+		err := SelectRanks(list, ranks, Options{BlockSize: 64, Workers: workers})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []int{99999, 50000, 0, 90000, 99000, 50000, 99900}, ranks)
+		for _, rank := range ranks {
+			assert.Equal(t, sorted[rank], list[rank], "workers %v rank %v", workers, rank)
+		}
+		//Each selected rank splits the list
+		assert.LessOrEqual(t, slices.Max(list[:90000]), list[90000])
+		assert.GreaterOrEqual(t, slices.Min(list[90000:99000]), list[90000])
+	}
+}
+
+func TestSelectRanksFunc_descending(t *testing.T) {
+	list := []string{"kiwi", "fig", "banana", "apple", "cherry", "pear", "plum"}
+
+	err := SelectRanksFunc(list, []int{0, 3, 6}, Options{BlockSize: 1, Order: Descending}, func(a, b string) bool { return a < b })
+
+	assert.NoError(t, err)
+	assert.Equal(t, "plum", list[0])
+	assert.Equal(t, "fig", list[3])
+	assert.Equal(t, "apple", list[6])
+}
+
+func TestQuantiles(t *testing.T) {
+	list := make([]float64, 1000)
+	for i := range list {
+		list[i] = float64(i + 1)
+	}
+	rand.Shuffle(len(list), func(i, j int) { list[i], list[j] = list[j], list[i] })
+
+	values, err := Quantiles(list, []float64{0.5, 0.9, 0.99, 0.999, 0, 1}, Options{BlockSize: 16, Workers: 4})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{500, 900, 990, 999, 1, 1000}, values)
+
+	values, err = QuantilesFunc(list, []float64{0.1}, Options{Order: Descending}, cmp.Less[float64])
+
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{901}, values)
+}
+
+func TestSelectRanks_errors(t *testing.T) {
+	cases := []struct {
+		list  []int
+		ranks []int
+		opts  Options
+		err   error
+	}{
+		{nil, []int{0}, Options{}, ErrEmptyInput},
+		{[]int{3, 2, 1}, []int{0, -1}, Options{}, ErrRankOutOfRange},
+		{[]int{3, 2, 1}, []int{3}, Options{}, ErrRankOutOfRange},
+		{[]int{3, 2, 1}, []int{1}, Options{BlockSize: -1}, ErrInvalidBlockSize},
+		{[]int{3, 2, 1}, []int{1}, Options{Order: Order(2)}, ErrInvalidOrder},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("%v ranks %v with %+v", c.list, c.ranks, c.opts), func(t *testing.T) {
+			original := slices.Clone(c.list)
+
+			err := SelectRanks(c.list, c.ranks, c.opts)
+			assert.ErrorIs(t, err, c.err)
+			err = SelectRanksFunc(c.list, c.ranks, c.opts, func(a, b int) bool { return a < b })
+			assert.ErrorIs(t, err, c.err)
+
+			assert.Equal(t, original, c.list)
+		})
+	}
+
+	for _, q := range []float64{-0.1, 1.5, math.NaN()} {
+		list := []int{3, 2, 1}
+		_, err := Quantiles(list, []float64{0.5, q}, Options{})
+		assert.ErrorIs(t, err, ErrInvalidQuantile)
+		assert.Equal(t, []int{3, 2, 1}, list)
+	}
+}
+
+func TestSelectTopN_strided(t *testing.T) {
+	for _, sorted := range []bool{false, true} {
+		for _, workers := range []int{1, 4} {
+			list := generateList(10 * 1000)
+			want := slices.Clone(list)
+			slices.Sort(want)
+
+			k, err := SelectTopN(list, 1000, Options{BlockSize: 64, Workers: workers, Sorted: sorted, Scheme: StridedBlocks})
+
+			assert.NoError(t, err)
+			assert.Equal(t, 1000, k)
+			top := slices.Clone(list[:1000])
+			slices.Sort(top)
+			assert.Equal(t, want[:1000], top, "sorted %v workers %v", sorted, workers)
+			assert.Equal(t, want[1000], list[1000], "sorted %v workers %v", sorted, workers)
+		}
+	}
+}
+
+func TestPartitionParallelContext_stridedCancelled(t *testing.T) {
+	list := generateList(10 * 1000)
+	original := slices.Clone(list)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := PartitionParallelContext(ctx, list, 0, len(list)-1, list[0], Options{BlockSize: 64, Workers: 4, Scheme: StridedBlocks})
+
+	assert.ErrorIs(t, err, context.Canceled)
+	slices.Sort(original)
+	slices.Sort(list)
+	assert.Equal(t, original, list)
+}
+
+func TestPartitionParallel_stats(t *testing.T) {
+	list := make([]int, 1000)
+	for i := range list {
+		list[i] = i * 7919 % 1000
+	}
+	var stats Stats
+
+	_, err := PartitionParallel(list, 0, len(list)-1, 500, Options{BlockSize: 16, Workers: 1, Stats: &stats})
+
+	assert.NoError(t, err)
+	//The block the single worker is left holding is moved into the middle and partitioned by a second round
+	assert.Equal(t, Stats{Partitions: 1, Rounds: 2, MaxRounds: 2}, stats)
+}
+
+func TestSelectTopN_stats(t *testing.T) {
+	for _, scheme := range []PartitionScheme{BlockNeutralisation, StridedBlocks} {
+		for _, workers := range []int{1, 4} {
+			var stats Stats
+			list := generateList(100 * 1000)
+
+			_, err := SelectTopN(list, 5000, Options{BlockSize: 2, Workers: workers, Scheme: scheme, Stats: &stats})
+
+			assert.NoError(t, err)
+			description := fmt.Sprintf("scheme %v workers %v stats %+v", scheme, workers, stats)
+			assert.Positive(t, stats.Partitions, description)
+			assert.GreaterOrEqual(t, stats.Rounds, stats.Partitions, description)
+			assert.GreaterOrEqual(t, stats.MaxRounds, 1, description)
+			assert.LessOrEqual(t, stats.MaxRounds, stats.Rounds, description)
+		}
+	}
+}
+
+func TestSelectTopNContext_cancelled(t *testing.T) {
+	list := generateList(10 * 1000)
+	original := slices.Clone(list)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := SelectTopNContext(ctx, list, 100, Options{BlockSize: 64, Workers: 4})
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, original, list)
+}
+
+func TestSelectTopNFuncContext_cancelledMidway(t *testing.T) {
+	for _, sorted := range []bool{false, true} {
+		for _, workers := range []int{1, 4} {
+			list := generateList(100 * 1000)
+			original := slices.Clone(list)
+			slices.Sort(original)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			//Cancel partway through the selection, after the first rounds have moved elements around
+			var calls atomic.Int64
+			less := func(a, b int) bool {
+				if calls.Add(1) == 150*1000 {
+					cancel()
+				}
+				return cmp.Less(a, b)
+			}
+
+			_, err := SelectTopNFuncContext(ctx, list, 50*1000, Options{BlockSize: 64, Workers: workers, Sorted: sorted}, less)
+
+			assert.ErrorIs(t, err, context.Canceled, fmt.Sprint("sorted ", sorted, " workers ", workers))
+			slices.Sort(list)
+			assert.Equal(t, original, list, fmt.Sprint("sorted ", sorted, " workers ", workers))
+		}
+	}
+}
+
+func TestSelectTopNContext_deadline(t *testing.T) {
+	list := generateList(100 * 1000)
+	original := slices.Clone(list)
+	slices.Sort(original)
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	_, err := SelectTopNContext(ctx, list, 100, Options{})
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	slices.Sort(list)
+	assert.Equal(t, original, list)
+}
+
+func TestPartitionParallel(t *testing.T) {
+	list := []int{1, 4, 7, 3, 2, 9, 10, 8, 5, 6}
+
+	pivotIndex, err := PartitionParallel(list, 0, len(list)-1, 8, Options{BlockSize: 2, Workers: 1})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 4, 7, 3, 2, 5, 6, 8, 9, 10}, list)
+	assert.Equal(t, 7, pivotIndex)
+}
+
+func TestPartitionParallel_descending(t *testing.T) {
+	list := []int{1, 4, 7, 3, 2, 9, 10, 8, 5, math.MinInt}
+
+	pivotIndex, err := PartitionParallel(list, 0, len(list)-1, 5, Options{BlockSize: 2, Workers: 1, Order: Descending})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 4, pivotIndex)
+	assert.ElementsMatch(t, []int{7, 9, 10, 8}, list[:4])
+	assert.ElementsMatch(t, []int{1, 4, 3, 2, 5, math.MinInt}, list[4:])
+}
+
+func TestPartitionParallelThreeWay(t *testing.T) {
+	list := []int{2, 4, 7, 3, 1, 9, 2, 2, 5, 2, 4}
+
+	lt, gt, err := PartitionParallelThreeWay(list, 0, len(list)-1, 2, Options{BlockSize: 2, Workers: 2})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, lt)
+	assert.Equal(t, 5, gt)
+	assert.Equal(t, []int{1}, list[:lt])
+	assert.Equal(t, []int{2, 2, 2, 2}, list[lt:gt])
+	assert.ElementsMatch(t, []int{4, 7, 3, 9, 5, 4}, list[gt:])
+
+	_, _, err = PartitionParallelThreeWay([]int{}, 0, 0, 2, Options{})
+	assert.ErrorIs(t, err, ErrEmptyInput)
+	_, _, err = PartitionParallelThreeWayFunc(list, 3, 2, 2, Options{}, func(a, b int) bool { return a < b })
+	assert.ErrorIs(t, err, ErrInvalidRange)
+}
+
+func TestPartitionParallelThreeWayFunc_descending(t *testing.T) {
+	list := []string{"b", "a", "c", "b", "d", "a", "b"}
+
+	lt, gt, err := PartitionParallelThreeWayFunc(list, 1, 5, "b", Options{BlockSize: 1, Order: Descending}, func(a, b string) bool { return a < b })
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, lt)
+	assert.Equal(t, 4, gt)
+	assert.ElementsMatch(t, []string{"c", "d"}, list[1:lt])
+	assert.Equal(t, []string{"b"}, list[lt:gt])
+	assert.ElementsMatch(t, []string{"a", "a"}, list[gt:6])
+	assert.Equal(t, "b", list[0])
+	assert.Equal(t, "b", list[6])
+}
+
+func TestPartitionParallel_errors(t *testing.T) {
+	cases := []struct {
+		list   []int
+		lo, hi int
+		opts   Options
+		err    error
+	}{
+		{nil, 0, 0, Options{}, ErrEmptyInput},
+		{[]int{3, 2, 1}, -1, 2, Options{}, ErrInvalidRange},
+		{[]int{3, 2, 1}, 0, 3, Options{}, ErrInvalidRange},
+		{[]int{3, 2, 1}, 2, 1, Options{}, ErrInvalidRange},
+		{[]int{3, 2, 1}, 0, 2, Options{BlockSize: -4}, ErrInvalidBlockSize},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("%v [%v, %v] with %+v", c.list, c.lo, c.hi, c.opts), func(t *testing.T) {
+			original := slices.Clone(c.list)
+
+			_, err := PartitionParallel(c.list, c.lo, c.hi, 2, c.opts)
+			assert.ErrorIs(t, err, c.err)
+			_, err = PartitionParallelFunc(c.list, c.lo, c.hi, 2, c.opts, func(a, b int) bool { return a < b })
+			assert.ErrorIs(t, err, c.err)
+
+			assert.Equal(t, original, c.list)
+		})
+	}
+}
+
+func TestPartitionParallelFuncContext_cancelledMidway(t *testing.T) {
+	list := generateList(100 * 1000)
+	original := slices.Clone(list)
+	slices.Sort(original)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var calls atomic.Int64
+	less := func(a, b int) bool {
+		if calls.Add(1) == 10*1000 {
+			cancel()
+		}
+		return cmp.Less(a, b)
+	}
+
+	_, err := PartitionParallelFuncContext(ctx, list, 0, len(list)-1, original[len(original)/2], Options{BlockSize: 64, Workers: 4}, less)
+
+	assert.ErrorIs(t, err, context.Canceled)
+	slices.Sort(list)
+	assert.Equal(t, original, list)
+}
+
+func BenchmarkPartitionParallel_schemes(b *testing.B) {
+	list := generateList(1000 * 1000)
+	pivot := list[0]
+	schemes := map[string]PartitionScheme{"neutralisation": BlockNeutralisation, "strided": StridedBlocks}
+	for _, name := range []string{"neutralisation", "strided"} {
+		for _, workers := range []int{1, 4, 8} {
+			b.Run(fmt.Sprintf("%v/workers-%v", name, workers), func(b *testing.B) {
+				work := make([]int, len(list))
+				for i := 0; i < b.N; i++ {
+					copy(work, list)
+					if _, err := PartitionParallel(work, 0, len(work)-1, pivot, Options{Workers: workers, Scheme: schemes[name]}); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkSelectTopN_sorted(b *testing.B) {
+	n := 1000 * 1000
+	original := generateList(n)
+	list := make([]int, n)
+
+	for _, top := range []int{100, 10 * 1000, 100 * 1000} {
+		b.Run(fmt.Sprintf("sorted-option/top-%v", top), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				copy(list, original)
+				SelectTopN(list, top, Options{Sorted: true})
+			}
+		})
+		b.Run(fmt.Sprintf("select-then-sort/top-%v", top), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				copy(list, original)
+				SelectTopN(list, top, Options{})
+				slices.Sort(list[:top])
+			}
+		})
+	}
+}
+
+func BenchmarkSelectTopN_lowCardinality(b *testing.B) {
+	n := 1000 * 1000
+	original := make([]int, n)
+	list := make([]int, n)
+
+	for _, values := range []int{1, 4, 16, 1000} {
+		for i := range original {
+			original[i] = rand.IntN(values)
+		}
+
+		b.Run(fmt.Sprintf("values-%v", values), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				copy(list, original)
+				SelectTopN(list, n/2, Options{})
+			}
+		})
+	}
+}
+
+func BenchmarkSelectTopN_stealing(b *testing.B) {
+	n := 1000 * 1000
+	original := generateList(n)
+	list := make([]int, n)
+
+	for _, workers := range []int{2, 4, 8} {
+		for _, parkedOnly := range []bool{false, true} {
+			name := "stealing"
+			if parkedOnly {
+				name = "park-and-exit"
+			}
+			b.Run(fmt.Sprintf("%v/workers-%v", name, workers), func(b *testing.B) {
+				s, err := NewSelector[int](Options{Workers: workers})
+				if err != nil {
+					b.Fatal(err)
+				}
+				//Idle workers only carry on with parked blocks, as before they could steal
+				s.p.blocks.stealing.parkedOnly = parkedOnly
+				for i := 0; i < b.N; i++ {
+					copy(list, original)
+					if _, err := s.SelectTopN(list, n/2); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}